@@ -0,0 +1,81 @@
+package zaploki
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// CredentialsProvider adds credentials to a push request. It is called for
+// every request, so secrets from a vault or rotated files are used as soon as
+// they change.
+type CredentialsProvider interface {
+	Apply(req *http.Request) error
+}
+
+// CredentialsProviderFunc adapts a function to a CredentialsProvider
+type CredentialsProviderFunc func(req *http.Request) error
+
+func (f CredentialsProviderFunc) Apply(req *http.Request) error {
+	return f(req)
+}
+
+// BasicAuthProvider returns a CredentialsProvider that asks credentials for
+// the username and password of every request
+func BasicAuthProvider(credentials func() (username, password string, err error)) CredentialsProvider {
+	return CredentialsProviderFunc(func(req *http.Request) error {
+		username, password, err := credentials()
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// authorize adds the configured credentials to req
+func (c *Client) authorize(req *http.Request) error {
+	if c.config.Credentials != nil {
+		if err := c.config.Credentials.Apply(req); err != nil {
+			return fmt.Errorf("failed to get credentials: %w", err)
+		}
+		return nil
+	}
+
+	token, err := c.bearerToken()
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		if token, err = c.oauth.get(req.Context()); err != nil {
+			return err
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+
+	if c.config.Username != "" && c.config.Password != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	} else if user := req.URL.User; user != nil {
+		// credentials in the url, as Grafana Cloud hands them out
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+	return nil
+}
+
+// bearerToken returns BearerToken or the content of BearerTokenFile. The file
+// is read for every request, so rotated secrets are picked up.
+func (c *Client) bearerToken() (string, error) {
+	if c.config.BearerToken != "" || c.config.BearerTokenFile == "" {
+		return c.config.BearerToken, nil
+	}
+	b, err := os.ReadFile(c.config.BearerTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read bearer token: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,124 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasicAuth(t *testing.T) {
+	headers := requestHeaders(t, Config{Username: "user", Password: "secret"})
+	assert.Equal(t, "Basic dXNlcjpzZWNyZXQ=", headers.Get("Authorization"))
+}
+
+func TestBearerToken(t *testing.T) {
+	headers := requestHeaders(t, Config{BearerToken: "token", Username: "user", Password: "secret"})
+	assert.Equal(t, "Bearer token", headers.Get("Authorization"))
+
+	file := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(file, []byte("from-file\n"), 0o600))
+	headers = requestHeaders(t, Config{BearerTokenFile: file})
+	assert.Equal(t, "Bearer from-file", headers.Get("Authorization"))
+}
+
+func TestOAuth2(t *testing.T) {
+	var fetched atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		id, secret, _ := r.BasicAuth()
+		assert.Equal(t, "client", id)
+		assert.Equal(t, "secret", secret)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "logs:write", r.PostForm.Get("scope"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	cfg := Config{OAuth2: &OAuth2{
+		TokenURL:     tokenServer.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"logs:write"},
+	}}
+	headers := requestHeaders(t, cfg)
+	assert.Equal(t, "Bearer access", headers.Get("Authorization"))
+
+	tokens := newOAuthTokens(cfg.OAuth2, http.DefaultClient)
+	for i := 0; i < 3; i++ {
+		token, err := tokens.get(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "access", token)
+	}
+	assert.Equal(t, int32(2), fetched.Load(), "Expected the token to be cached")
+}
+
+func TestOAuth2ShortLivedToken(t *testing.T) {
+	var fetched atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","expires_in":20}`))
+	}))
+	defer tokenServer.Close()
+
+	tokens := newOAuthTokens(&OAuth2{TokenURL: tokenServer.URL}, http.DefaultClient)
+	for i := 0; i < 3; i++ {
+		_, err := tokens.get(context.Background())
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), fetched.Load(), "Expected a token that expires within the margin to be cached")
+}
+
+func TestCredentialsProvider(t *testing.T) {
+	headers := requestHeaders(t, Config{
+		Username: "ignored",
+		Password: "ignored",
+		Credentials: BasicAuthProvider(func() (string, string, error) {
+			return "user", "first", nil
+		}),
+	})
+	username, got, ok := (&http.Request{Header: headers}).BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "first", got)
+
+	headers = requestHeaders(t, Config{Credentials: CredentialsProviderFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Custom rotated")
+		return nil
+	})})
+	assert.Equal(t, "Custom rotated", headers.Get("Authorization"))
+}
+
+func TestURLCredentials(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "123456" || pass != "glc_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	u, err := url.Parse(mockServer.URL)
+	assert.NoError(t, err)
+	u.User = url.UserPassword("123456", "glc_token")
+	c := NewClient(context.Background(), Config{Url: u.String()})
+	defer c.Stop()
+	assert.NoError(t, c.CheckConnection(context.Background()))
+
+	u.User = url.UserPassword("123456", "wrong")
+	c = NewClient(context.Background(), Config{Url: u.String()})
+	defer c.Stop()
+	err = c.CheckConnection(context.Background())
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "wrong", "Expected the password to be redacted")
+}
@@ -0,0 +1,143 @@
+package zaploki
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// batch groups the pending stream values by their label set
+type batch struct {
+	streams map[string]*batchStream
+	keys    []string
+	lines   int
+	bytes   int
+	// buffered is the size of the log lines added to the batch, including
+	// collapsed repeats
+	buffered int
+	// entries is the number of log lines added to the batch, including
+	// collapsed repeats
+	entries int
+	waiters []chan error
+}
+
+// batchStream is a stream that collects values for a batch. Repeated lines
+// are counted instead of added when collapsing repeats.
+type batchStream struct {
+	stream
+	lastKey string
+	repeats map[int]int
+}
+
+func newBatch() *batch {
+	return &batch{streams: make(map[string]*batchStream)}
+}
+
+// add appends v to the stream of labels and tenant. If repeatKey is not
+// empty and matches the key of the previous value of the stream, v is counted
+// as a repeat of that value instead.
+func (b *batch) add(tenant string, labels map[string]string, v streamValue, repeatKey string) {
+	b.buffered += len(v[1])
+	b.entries++
+	key := labelsKey(labels)
+	if tenant != "" {
+		key = strconv.Quote(tenant) + ":" + key
+	}
+	s, ok := b.streams[key]
+	if !ok {
+		s = &batchStream{stream: stream{Stream: labels, tenant: tenant}}
+		b.streams[key] = s
+		b.keys = append(b.keys, key)
+	}
+	if repeatKey != "" && repeatKey == s.lastKey && len(s.Values) > 0 {
+		if s.repeats == nil {
+			s.repeats = make(map[int]int)
+		}
+		s.repeats[len(s.Values)-1]++
+		return
+	}
+	s.lastKey = repeatKey
+	s.Values = append(s.Values, v)
+	b.lines++
+	b.bytes += v.size()
+}
+
+func (b *batch) len() int {
+	return b.lines
+}
+
+func (b *batch) reset() {
+	b.streams = make(map[string]*batchStream)
+	b.keys = b.keys[:0]
+	b.lines = 0
+	b.bytes = 0
+	b.buffered = 0
+	b.entries = 0
+	b.waiters = nil
+}
+
+func (b *batch) request() lokiPushRequest {
+	streams := make([]stream, 0, len(b.keys))
+	for _, key := range b.keys {
+		streams = append(streams, b.streams[key].withRepeats())
+	}
+	return lokiPushRequest{Streams: streams}
+}
+
+// withRepeats returns the stream with the repeat count added to every line
+// that was repeated
+func (s *batchStream) withRepeats() stream {
+	if len(s.repeats) == 0 {
+		return s.stream
+	}
+	values := make([]streamValue, len(s.Values))
+	copy(values, s.Values)
+	for i, n := range s.repeats {
+		values[i] = values[i].withLine(withCount(values[i][1], n+1))
+	}
+	return s.withValues(values)
+}
+
+// withCount adds a count field to a line, using the line's format
+func withCount(line string, count int) string {
+	if strings.HasPrefix(line, "{") {
+		if raw, err := appendFields([]byte(line), map[string]any{"count": count}); err == nil {
+			return string(raw)
+		}
+	}
+	return fmt.Sprintf("%s count=%d", line, count)
+}
+
+// mergeLabels returns base extended by extra, without modifying either map
+func mergeLabels(base, extra map[string]string) map[string]string {
+	if len(extra) == 0 {
+		return base
+	}
+	labels := make(map[string]string, len(base)+len(extra))
+	for k, v := range base {
+		labels[k] = v
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
+
+// labelsKey renders labels in a stable form so equal label sets share a stream
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(strconv.Quote(k))
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(labels[k]))
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
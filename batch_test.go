@@ -0,0 +1,76 @@
+package zaploki
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchCollapsesRepeats(t *testing.T) {
+	b := newBatch()
+	labels := map[string]string{"app": "test"}
+	b.add("", labels, streamValue{"1", `{"msg":"loop"}`}, "loop")
+	b.add("", labels, streamValue{"2", `{"msg":"loop"}`}, "loop")
+	b.add("", labels, streamValue{"3", `{"msg":"loop"}`}, "loop")
+	b.add("", labels, streamValue{"4", "plain"}, "plain")
+	b.add("", labels, streamValue{"5", "plain"}, "plain")
+	b.add("", labels, streamValue{"6", `{"msg":"loop"}`}, "loop")
+
+	assert.Equal(t, 3, b.len(), "Expected repeats not to count as lines")
+
+	values := b.request().Streams[0].Values
+	assert.Len(t, values, 3)
+
+	var line map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(values[0][1]), &line))
+	assert.Equal(t, float64(3), line["count"])
+	assert.Equal(t, "plain count=2", values[1][1])
+	assert.Equal(t, `{"msg":"loop"}`, values[2][1])
+}
+
+func TestBatchGroupsStreamsByLabelSet(t *testing.T) {
+	b := newBatch()
+	b.add("", map[string]string{"app": "test", "tenant": "a"}, streamValue{"1", "first"}, "")
+	b.add("", map[string]string{"app": "test", "tenant": "b"}, streamValue{"2", "second"}, "")
+	b.add("", map[string]string{"tenant": "a", "app": "test"}, streamValue{"3", "third"}, "")
+	b.add("", map[string]string{"app": "test"}, streamValue{"4", "fourth"}, "")
+
+	assert.Equal(t, 4, b.len(), "Expected lines of all streams to count towards the batch")
+	req := b.request()
+	assert.Len(t, req.Streams, 3, "Expected one stream per label set")
+	assert.Equal(t, map[string]string{"app": "test", "tenant": "a"}, req.Streams[0].Stream)
+	assert.Equal(t, []streamValue{{"1", "first"}, {"3", "third"}}, req.Streams[0].Values)
+	assert.Equal(t, []streamValue{{"2", "second"}}, req.Streams[1].Values)
+	assert.Equal(t, []streamValue{{"4", "fourth"}}, req.Streams[2].Values)
+}
+
+func TestCollapseRepeatsKeepsFields(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    100,
+		BatchMaxWait:    10 * time.Second,
+		Labels:          map[string]string{"app": "test"},
+		CollapseRepeats: true,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "request", map[string]any{"user": "a"}))
+	assert.NoError(t, c.PushEntry(ctx, "info", "request", map[string]any{"user": "a"}))
+	assert.NoError(t, c.PushEntry(ctx, "info", "request", map[string]any{"user": "b"}))
+	assert.NoError(t, c.Flush(ctx))
+
+	values := (<-received).Streams[0].Values
+	assert.Len(t, values, 2, "Expected only identical lines to be collapsed")
+	assert.Contains(t, values[0][1], `"user":"a","count":2`)
+	assert.Contains(t, values[1][1], `"user":"b"`)
+}
@@ -0,0 +1,104 @@
+package zaploki
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of sending a request while loki is
+// considered down after repeated failures
+var ErrCircuitOpen = errors.New("loki circuit breaker is open")
+
+const defaultBreakerCooldown = 30 * time.Second
+
+// breaker stops requests to loki after a number of consecutive failures.
+// After the cooldown one probe request is let through, which closes the
+// breaker again if it succeeds.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    *slog.Logger
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration, logger *slog.Logger) *breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown, logger: logger}
+}
+
+// allow returns ErrCircuitOpen if a request must not be sent, and whether
+// the request is the probe of an open breaker
+func (b *breaker) allow() (bool, error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return false, nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false, ErrCircuitOpen
+	}
+	b.probing = true
+	return true, nil
+}
+
+// record updates the breaker with the result of a request that was allowed.
+// Canceled requests say nothing about loki and only end a probe.
+func (b *breaker) record(err error, probe bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if !countsAsFailure(err) {
+		if b.failures >= b.threshold {
+			b.logger.Info("loki circuit breaker closed")
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+		if !probe {
+			b.logger.Warn("loki circuit breaker opened", slog.Int("failures", b.failures), slog.Duration("cooldown", b.cooldown))
+		}
+	}
+}
+
+// countsAsFailure reports whether err means that loki is unavailable, as
+// opposed to loki rejecting a request
+func countsAsFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode >= 500 || respErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package zaploki
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(2, 20*time.Millisecond, slog.Default())
+	down := errors.New("connection refused")
+
+	probe, err := b.allow()
+	assert.NoError(t, err)
+	assert.False(t, probe)
+	b.record(down, probe)
+	_, err = b.allow()
+	assert.NoError(t, err, "Expected the breaker to stay closed below the threshold")
+	b.record(down, false)
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	time.Sleep(30 * time.Millisecond)
+	probe, err = b.allow()
+	assert.NoError(t, err, "Expected a probe after the cooldown")
+	assert.True(t, probe)
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen, "Expected one probe at a time")
+	b.record(down, probe)
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen, "Expected a failed probe to open the breaker again")
+
+	time.Sleep(30 * time.Millisecond)
+	probe, err = b.allow()
+	assert.NoError(t, err)
+	b.record(nil, probe)
+	_, err = b.allow()
+	assert.NoError(t, err, "Expected a successful probe to close the breaker")
+}
+
+func TestBreakerIgnoresCanceledRequests(t *testing.T) {
+	b := newBreaker(1, 20*time.Millisecond, slog.Default())
+	b.record(errors.New("connection refused"), false)
+	b.record(context.Canceled, false)
+	_, err := b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen, "Expected a canceled request not to close the breaker")
+
+	time.Sleep(30 * time.Millisecond)
+	probe, err := b.allow()
+	assert.NoError(t, err)
+	assert.True(t, probe)
+	// a request that was sent before the breaker opened
+	b.record(errors.New("connection refused"), false)
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen, "Expected the probe to continue")
+
+	b.record(context.Canceled, probe)
+	time.Sleep(30 * time.Millisecond)
+	probe, err = b.allow()
+	assert.NoError(t, err, "Expected a canceled probe to let another probe through")
+	assert.True(t, probe)
+}
+
+func TestBreakerIgnoresRejectedRequests(t *testing.T) {
+	b := newBreaker(1, time.Minute, slog.Default())
+	b.record(&ResponseError{StatusCode: 400}, false)
+	_, err := b.allow()
+	assert.NoError(t, err)
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	var b *breaker = newBreaker(0, 0, slog.Default())
+	b.record(errors.New("connection refused"), false)
+	_, err := b.allow()
+	assert.NoError(t, err)
+}
+
+func TestClientBreaker(t *testing.T) {
+	var hits atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:              mockServer.URL,
+		BatchMaxSize:     100,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Minute,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "first", nil))
+	assert.Error(t, c.Flush(ctx))
+	assert.NoError(t, c.Push(ctx, "info", "second", nil))
+	assert.ErrorIs(t, c.Flush(ctx), ErrCircuitOpen)
+	assert.Equal(t, int32(1), hits.Load(), "Expected no request while the breaker is open")
+}
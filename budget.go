@@ -0,0 +1,76 @@
+package zaploki
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRetryBudgetExceeded is returned for batches that are not retried because
+// the retry budget is used up
+var ErrRetryBudgetExceeded = errors.New("loki retry budget exceeded")
+
+// retryBudget limits how many batches are retried per minute and how large
+// the batches that are being retried may be in total, so retrying during an
+// outage doesn't add load or hold unbounded memory
+type retryBudget struct {
+	perMinute int
+	maxBytes  int64
+
+	mu          sync.Mutex
+	windowStart time.Time
+	used        int
+	bytes       int64
+}
+
+func newRetryBudget(perMinute, maxBytes int) *retryBudget {
+	if perMinute <= 0 && maxBytes <= 0 {
+		return nil
+	}
+	return &retryBudget{perMinute: perMinute, maxBytes: int64(maxBytes)}
+}
+
+// acquire reserves the budget for retrying a batch of size bytes. It returns
+// false if the budget is used up.
+func (b *retryBudget) acquire(size int64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now := time.Now(); now.Sub(b.windowStart) >= time.Minute {
+		b.windowStart = now
+		b.used = 0
+	}
+	if b.perMinute > 0 && b.used >= b.perMinute {
+		return false
+	}
+	if b.maxBytes > 0 && b.bytes+size > b.maxBytes {
+		return false
+	}
+	b.used++
+	b.bytes += size
+	return true
+}
+
+// release returns the bytes of a batch that is no longer retried
+func (b *retryBudget) release(size int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bytes -= size
+}
+
+// size returns the uncompressed size of the lines of r
+func (r lokiPushRequest) size() int64 {
+	var n int64
+	for _, s := range r.Streams {
+		for _, v := range s.Values {
+			n += int64(v.size())
+		}
+	}
+	return n
+}
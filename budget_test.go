@@ -0,0 +1,47 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBudget(t *testing.T) {
+	var hits atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:                  mockServer.URL,
+		BatchMaxSize:         100,
+		MaxRetries:           1,
+		RetryMinBackoff:      time.Millisecond,
+		RetryBudgetPerMinute: 1,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "first", nil))
+	assert.Error(t, c.Flush(ctx))
+	assert.Equal(t, int32(2), hits.Load(), "Expected the first batch to be retried")
+
+	assert.NoError(t, c.Push(ctx, "info", "second", nil))
+	assert.ErrorIs(t, c.Flush(ctx), ErrRetryBudgetExceeded)
+	assert.Equal(t, int32(3), hits.Load(), "Expected no retry beyond the budget")
+}
+
+func TestRetryBudgetBytes(t *testing.T) {
+	b := newRetryBudget(0, 100)
+	assert.True(t, b.acquire(60))
+	assert.False(t, b.acquire(60), "Expected the bytes in retry to be limited")
+	b.release(60)
+	assert.True(t, b.acquire(60))
+}
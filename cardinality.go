@@ -0,0 +1,40 @@
+package zaploki
+
+import "log/slog"
+
+// overflowLabel marks the stream that lines beyond MaxStreams are sent to
+const overflowLabel = "label_overflow"
+
+// limitStreams returns labels, or the labels of the overflow stream once
+// MaxStreams distinct label sets were used. Must be called from the batching
+// loop.
+func (c *Client) limitStreams(labels map[string]string) map[string]string {
+	if c.config.MaxStreams <= 0 {
+		return labels
+	}
+	key := labelsKey(labels)
+	if c.streams[key] {
+		return labels
+	}
+	if len(c.streams) < c.config.MaxStreams {
+		if c.streams == nil {
+			c.streams = make(map[string]bool)
+		}
+		c.streams[key] = true
+		return labels
+	}
+
+	if !c.streamsExceeded {
+		c.streamsExceeded = true
+		c.logger.Warn("too many distinct label sets, sending further ones to the overflow stream",
+			slog.Int("max_streams", c.config.MaxStreams), slog.String("labels", key))
+	}
+	overflow := make(map[string]string, len(c.config.Labels)+1)
+	for k, v := range c.config.Labels {
+		if c.labelTemplates[k] == nil {
+			overflow[k] = v
+		}
+	}
+	overflow[overflowLabel] = "true"
+	return overflow
+}
@@ -0,0 +1,41 @@
+package zaploki
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxStreams(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+		LabelKeys:    []string{"request_id"},
+		MaxStreams:   2,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3", "1", "4"} {
+		assert.NoError(t, c.PushEntry(ctx, "info", "request", map[string]any{"request_id": id}))
+	}
+	assert.NoError(t, c.Flush(ctx))
+
+	req := <-received
+	assert.Len(t, req.Streams, 3, "Expected the label sets beyond the limit to share a stream")
+	assert.Equal(t, map[string]string{"app": "test", "request_id": "1"}, req.Streams[0].Stream)
+	assert.Len(t, req.Streams[0].Values, 2)
+	assert.Equal(t, map[string]string{"app": "test", "request_id": "2"}, req.Streams[1].Stream)
+	assert.Equal(t, map[string]string{"app": "test", "label_overflow": "true"}, req.Streams[2].Stream)
+	assert.Len(t, req.Streams[2].Values, 2)
+}
@@ -0,0 +1,49 @@
+package zaploki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const defaultCheckTimeout = 10 * time.Second
+
+// CheckConnection pushes an empty request to every loki endpoint, so wrong
+// urls, credentials or tenants are reported right away instead of when the
+// first batch is sent
+func (c *Client) CheckConnection(ctx context.Context) error {
+	if c.grpc != nil {
+		if err := c.pushGRPC(ctx, lokiPushRequest{}); err != nil {
+			return fmt.Errorf("%s: %w", c.config.GRPCAddress, err)
+		}
+		return nil
+	}
+
+	body, err := c.encodeRequest(lokiPushRequest{Streams: []stream{}})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, e := range c.endpoints {
+		if err := c.postTo(ctx, e.url, "", body); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", redactURL(e.url), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// verify checks the connection to loki on start and logs the result
+func (c *Client) verify() {
+	timeout := c.config.RequestTimeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+	defer cancel()
+	if err := c.CheckConnection(ctx); err != nil {
+		c.logger.Error("failed to connect to loki", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,33 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConnection(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "user" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		req := decodePushRequest(t, r)
+		assert.Empty(t, req.Streams, "Expected an empty push")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{Url: mockServer.URL, Username: "user", Password: "secret"})
+	defer c.Stop()
+	assert.NoError(t, c.CheckConnection(context.Background()))
+
+	c = NewClient(context.Background(), Config{Url: mockServer.URL, Username: "user", Password: "wrong"})
+	defer c.Stop()
+	var respErr *ResponseError
+	assert.ErrorAs(t, c.CheckConnection(context.Background()), &respErr)
+	assert.Equal(t, http.StatusUnauthorized, respErr.StatusCode)
+}
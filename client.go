@@ -0,0 +1,897 @@
+package zaploki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+)
+
+// ErrStopped is returned when pushing to or flushing a stopped client
+var ErrStopped = errors.New("loki client is stopped")
+
+// Client batches log lines and pushes them to loki. It is used by the zap
+// integration returned by New but can also be used on its own.
+type Client struct {
+	config *Config
+	ctx    context.Context
+	cancel context.CancelFunc
+	// dispatchCtx is the context of the batches sent by dispatch. It is
+	// canceled at the shutdown deadline to abandon the requests in flight.
+	dispatchCtx    context.Context
+	cancelDispatch context.CancelFunc
+	client         *http.Client
+	logger         *slog.Logger
+	breaker        *breaker
+	oauth          *oauthTokens
+	sigv4          *sigv4Signer
+	zstd           *zstd.Encoder
+	// grpc is the connection to GRPCAddress
+	grpc *grpc.ClientConn
+	// retryBudget is nil without RetryBudgetPerMinute and RetryBudgetBytes
+	retryBudget *retryBudget
+	// lineRate and byteRate are nil without MaxLinesPerSecond and
+	// MaxBytesPerSecond
+	lineRate  *tokenBucket
+	byteRate  *tokenBucket
+	wal       *wal
+	endpoints []*endpoint
+	// lineKeys are the keys of the fields JSON lines are parsed from
+	lineKeys lineKeys
+	// labelKeys, metadataKeys, dropFields, redactFields and hashKeys hold
+	// LabelKeys, MetadataKeys, DropFields, RedactFields and HashFields for
+	// lookups
+	labelKeys    map[string]bool
+	metadataKeys map[string]bool
+	dropFields   map[string]bool
+	redactFields map[string]bool
+	hashKeys     map[string]bool
+	staticFields []field
+	// streams are the label sets that were used, up to MaxStreams
+	streams         map[string]bool
+	streamsExceeded bool
+	// labelTemplates are the templates of the label values, owned by the
+	// batching loop like the labels
+	labelTemplates map[string]*template.Template
+	// configured holds the labels of the config or of SetLabels, which
+	// override the detected labels
+	configured map[string]string
+	// detected holds the labels of the environment and of the
+	// LabelProviders, and environment only those of the environment
+	detected, environment map[string]string
+	// provided holds the last labels of every LabelProvider
+	provided []map[string]string
+	health   health
+	// lastRecycle is the time in unix nanoseconds the idle connections were
+	// last closed
+	lastRecycle atomic.Int64
+	// nextEndpoint counts the requests for round robin load balancing
+	nextEndpoint atomic.Uint64
+	quit         chan struct{}
+	entry        chan logEntry
+	flush        chan flushRequest
+	waitGroup    sync.WaitGroup
+	batch        *batch
+	ticker       *time.Ticker
+	// inflightSlots limits the number of concurrent requests when
+	// MaxInflightRequests is above 1
+	inflightSlots chan struct{}
+	inflight      sync.WaitGroup
+	// inflightLines is the number of log lines in the requests in flight
+	inflightLines atomic.Int64
+	paused        atomic.Bool
+	unbatched     atomic.Bool
+	updates       chan func()
+	// heldReady wakes the run loop to send the held batches
+	heldReady chan struct{}
+	heldMu    sync.Mutex
+	held      []pendingRequest
+	// notBefore is the time in unix nanoseconds before which no request is
+	// sent, because loki asked to retry later
+	notBefore atomic.Int64
+	enqueued  atomic.Uint64
+	sent      atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+	filtered  atomic.Uint64
+	truncated atomic.Uint64
+	// buffered is the size of the log lines that were queued but not sent yet
+	buffered atomic.Int64
+	// deadLetterMu serializes access to DeadLetterFile
+	deadLetterMu sync.Mutex
+	fallbackMu   sync.Mutex
+	// enqueueMu is held for reading while producers add entries to the
+	// queue
+	enqueueMu sync.RWMutex
+	stopOnce  sync.Once
+	stopCtx   context.Context
+	stopErr   error
+}
+
+type lokiPushRequest struct {
+	Streams []stream `json:"streams"`
+}
+
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	Values []streamValue     `json:"values"`
+	// tenant is the loki tenant the stream is sent to, see TenantField
+	tenant string
+}
+
+// withValues returns a copy of s with other values
+func (s stream) withValues(values []streamValue) stream {
+	s.Values = values
+	return s
+}
+
+// streamValue holds the timestamp and the line of a log line, followed by
+// its structured metadata as a JSON object if it has any
+type streamValue []string
+
+// MarshalJSON encodes the structured metadata as an object, as loki expects
+func (v streamValue) MarshalJSON() ([]byte, error) {
+	if len(v) < 3 {
+		return json.Marshal([]string(v))
+	}
+	ts, _ := json.Marshal(v[0])
+	line, _ := json.Marshal(v[1])
+	return []byte(fmt.Sprintf("[%s,%s,%s]", ts, line, v[2])), nil
+}
+
+func (v *streamValue) UnmarshalJSON(data []byte) error {
+	var values []json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*v = make(streamValue, len(values))
+	for i, value := range values {
+		if i == 2 {
+			(*v)[i] = string(value)
+			continue
+		}
+		if err := json.Unmarshal(value, &(*v)[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withLine returns a copy of v with another line
+func (v streamValue) withLine(line string) streamValue {
+	c := append(streamValue{}, v...)
+	c[1] = line
+	return c
+}
+
+// timestamp returns the timestamp of the value in nanoseconds
+func (v streamValue) timestamp() int64 {
+	ts, _ := strconv.ParseInt(v[0], 10, 64)
+	return ts
+}
+
+// size returns the uncompressed size of the value's contents
+func (v streamValue) size() int {
+	n := 0
+	for _, s := range v {
+		n += len(s)
+	}
+	return n
+}
+
+type logEntry struct {
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+	Caller  string `json:"caller,omitempty"`
+	// ts is the time of the entry, sent to loki at nanosecond precision
+	ts  time.Time
+	raw string
+	// fields are the top level fields of raw once it is parsed, or nil if
+	// it is no JSON object. edited reports whether they were changed since
+	// raw was encoded.
+	fields         []field
+	parsed, edited bool
+	labels         map[string]string
+	// metadata is sent as structured metadata of the line
+	metadata map[string]string
+	tenant   string
+	// sent receives the result of the request that contains the entry, for
+	// producers that wait for the entry to be sent
+	sent chan error
+}
+
+// flushRequest asks the run loop to send the current batch and report the
+// result on done
+type flushRequest struct {
+	ctx  context.Context
+	done chan error
+}
+
+// NewClient creates a new loki client and starts its background batching loop
+func NewClient(ctx context.Context, cfg Config) *Client {
+	logger := cfg.InternalLogger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c := &Client{
+		config:       &cfg,
+		ctx:          ctx,
+		cancel:       cancel,
+		client:       newHTTPClient(&cfg, logger),
+		quit:         make(chan struct{}),
+		entry:        make(chan logEntry, cfg.QueueSize),
+		flush:        make(chan flushRequest),
+		heldReady:    make(chan struct{}, 1),
+		updates:      make(chan func()),
+		batch:        newBatch(),
+		endpoints:    newEndpoints(&cfg),
+		lineKeys:     newLineKeys(cfg.EncoderConfig),
+		labelKeys:    keySet(cfg.LabelKeys),
+		metadataKeys: keySet(metadataKeys(&cfg)),
+		dropFields:   keySet(cfg.DropFields),
+		redactFields: keySet(cfg.RedactFields),
+		hashKeys:     keySet(cfg.HashFields),
+		logger:       logger,
+		breaker:      newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, logger),
+		retryBudget:  newRetryBudget(cfg.RetryBudgetPerMinute, cfg.RetryBudgetBytes),
+		lineRate:     newTokenBucket(cfg.MaxLinesPerSecond),
+		byteRate:     newTokenBucket(cfg.MaxBytesPerSecond),
+	}
+
+	c.dispatchCtx, c.cancelDispatch = context.WithCancel(ctx)
+	c.oauth = newOAuthTokens(cfg.OAuth2, http.DefaultClient)
+	c.sigv4 = newSigV4Signer(cfg.SigV4)
+	checkGzipLevel(&cfg, logger)
+	c.zstd = newZstdEncoder(&cfg, logger)
+	c.grpc = dialGRPC(&cfg, logger)
+	c.staticFields = c.encodeStaticFields()
+	if len(cfg.HashFields) > 0 && cfg.HashSalt == "" {
+		logger.Warn("no HashSalt is configured, the values of HashFields may be guessed from their hashes")
+	}
+	c.configured = cfg.Labels
+	c.detectLabels()
+	c.applyLabels()
+	c.unbatched.Store(cfg.BatchMaxSize <= 1)
+	if cfg.MaxInflightRequests > 1 {
+		c.inflightSlots = make(chan struct{}, cfg.MaxInflightRequests)
+	}
+
+	c.lastRecycle.Store(time.Now().UnixNano())
+	if cfg.VerifyOnStart {
+		c.verify()
+	}
+	if cfg.QueueDir != "" {
+		c.openQueue()
+	}
+
+	c.waitGroup.Add(1)
+	go c.run()
+	return c
+}
+
+// openQueue opens QueueDir and holds the batches left by a previous process
+// for sending. Without a usable directory lines are only queued in memory.
+func (c *Client) openQueue() {
+	w, segments, err := openWAL(c.config.QueueDir, int64(c.config.QueueMaxBytes), c.logger)
+	if err != nil {
+		c.logger.Error("failed to open queue directory", slog.Any("error", err))
+		return
+	}
+	c.wal = w
+	if c.config.ReplayOrder == ReplayNewestFirst {
+		slices.Reverse(segments)
+	}
+	for _, s := range segments {
+		c.held = append(c.held, pendingRequest{req: s.req, lines: s.req.lines(), segment: s.name})
+	}
+	if len(c.held) > 0 {
+		c.wakeHeld()
+	}
+}
+
+// Push queues a log line with the given level and message. The labels are
+// merged into the configured labels for this line only.
+func (c *Client) Push(ctx context.Context, level, msg string, labels map[string]string) error {
+	return c.push(ctx, level, msg, labels, nil)
+}
+
+// PushEntry queues a log line with the given level and message. The fields
+// are added to the JSON encoded line.
+func (c *Client) PushEntry(ctx context.Context, level, msg string, fields map[string]any) error {
+	return c.push(ctx, level, msg, nil, fields)
+}
+
+func (c *Client) push(ctx context.Context, level, msg string, labels map[string]string, fields map[string]any) error {
+	entry := logEntry{
+		Level:   level,
+		Message: msg,
+		ts:      time.Now(),
+		labels:  labels,
+	}
+	raw, err := json.Marshal(struct {
+		Level     string  `json:"level"`
+		Timestamp float64 `json:"ts"`
+		Message   string  `json:"msg"`
+	}{level, epochSeconds(entry.ts), msg})
+	if err != nil {
+		return err
+	}
+	raw, err = appendFields(raw, fields)
+	if err != nil {
+		return err
+	}
+	entry.raw = string(raw)
+
+	return c.enqueue(ctx, entry)
+}
+
+// appendFields adds fields in key order to the JSON object in raw. Keys that
+// are already present in raw are not checked.
+func appendFields(raw []byte, fields map[string]any) ([]byte, error) {
+	if len(fields) == 0 {
+		return raw, nil
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	raw = bytes.TrimSuffix(raw, []byte("}"))
+	for _, k := range keys {
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(fields[k])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode field %q: %w", k, err)
+		}
+		if len(raw) > 1 {
+			raw = append(raw, ',')
+		}
+		raw = append(raw, key...)
+		raw = append(raw, ':')
+		raw = append(raw, value...)
+	}
+	return append(raw, '}'), nil
+}
+
+func (c *Client) enqueue(ctx context.Context, entry logEntry) error {
+	// the run loop waits for the producers that got past the quit check
+	// before it drains the queue for the last time
+	c.enqueueMu.RLock()
+	sent, err := c.queue(ctx, entry)
+	c.enqueueMu.RUnlock()
+	if err != nil || sent == nil {
+		return err
+	}
+	select {
+	case err := <-sent:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queue prepares entry and adds it to the queue. It returns the channel that
+// receives the result of the request if the producer waits for it.
+func (c *Client) queue(ctx context.Context, entry logEntry) (chan error, error) {
+	select {
+	case <-c.quit:
+		return nil, ErrStopped
+	default:
+	}
+
+	c.enqueued.Add(1)
+	if c.config.TimestampSource == TimestampSend || entry.ts.IsZero() {
+		entry.ts = time.Now()
+	}
+	entry.parse()
+	values := c.ruleValues(entry)
+	// LevelMapping may rename the level to a name zap doesn't know
+	flush := c.flushesOn(entry)
+	entry = c.prepare(entry)
+	if !c.applyRules(&entry, values) {
+		c.filtered.Add(1)
+		return nil, nil
+	}
+	if c.immediate() || flush {
+		entry.sent = make(chan error, 1)
+	}
+
+	// the fields are only encoded by the run loop, until then the size of the
+	// line as it was logged is counted
+	size := int64(len(entry.raw))
+	over := c.buffered.Add(size) > int64(c.config.MaxBufferedBytes)
+	if over && c.dropsNewest() {
+		c.drop(entry)
+		return entry.sent, nil
+	}
+	if over && c.dropsOldest() {
+		// make room for entry
+		c.dropOldest()
+	}
+	if err := c.offer(ctx, entry); err != nil {
+		c.buffered.Add(-size)
+		// the line was not queued
+		c.enqueued.Add(^uint64(0))
+		return nil, err
+	}
+	return entry.sent, nil
+}
+
+// flushesOn reports whether entry has a level that is enabled by
+// FlushOnLevel
+func (c *Client) flushesOn(entry logEntry) bool {
+	if c.config.FlushOnLevel == nil {
+		return false
+	}
+	level, err := zapcore.ParseLevel(entry.Level)
+	if err != nil {
+		return false
+	}
+	return c.config.FlushOnLevel.Enabled(level)
+}
+
+// immediate reports whether every entry is sent on its own while the
+// producer waits for the request to finish
+func (c *Client) immediate() bool {
+	return c.config.DisableBatching || c.unbatched.Load()
+}
+
+// Flush sends all pending log lines, including the ones still waiting to be
+// batched, to loki and waits for the request to finish. While paused the
+// lines are held instead, see Pause.
+func (c *Client) Flush(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case c.flush <- flushRequest{ctx: ctx, done: done}:
+	case <-c.quit:
+		return ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop stops the client after sending the pending log lines. Errors are
+// logged instead of returned.
+//
+// Deprecated: use Close, which reports whether the pending log lines were
+// sent.
+func (c *Client) Stop() {
+	if err := c.Close(context.Background()); err != nil {
+		c.logger.Error("failed to send logs", slog.Any("error", err))
+	}
+}
+
+// Close stops accepting new log lines, sends the pending ones and returns the
+// error of the final request. The final request is bounded by ctx. Calling
+// Close more than once returns the result of the first call.
+func (c *Client) Close(ctx context.Context) error {
+	c.stopOnce.Do(func() {
+		c.stopCtx = ctx
+		close(c.quit)
+	})
+	c.waitGroup.Wait()
+	c.cancel()
+	return c.stopErr
+}
+
+func (c *Client) run() {
+	c.resetTicker()
+	defer func() {
+		if c.ticker != nil {
+			c.ticker.Stop()
+		}
+	}()
+
+	defer func() {
+		// without Close the parent context is done, but the pending lines
+		// should still be sent
+		ctx := context.WithoutCancel(c.ctx)
+		select {
+		case <-c.quit:
+			ctx = c.stopCtx
+		default:
+			c.stopOnce.Do(func() {
+				close(c.quit)
+			})
+		}
+		if c.config.ShutdownTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.config.ShutdownTimeout)
+			defer cancel()
+		}
+		// the deadline bounds the requests in flight and the ones made while
+		// draining as well
+		stop := context.AfterFunc(ctx, c.cancelDispatch)
+		defer stop()
+
+		// producers that saw quit open may still be adding their entries
+		c.enqueueMu.Lock()
+		c.enqueueMu.Unlock()
+		c.drain()
+
+		lines := c.pendingLines()
+		c.stopErr = c.sendBatch(ctx)
+		// abandoned requests return once they see the canceled context
+		c.inflight.Wait()
+		c.wal.close()
+		if c.grpc != nil {
+			c.grpc.Close()
+		}
+		if c.zstd != nil {
+			c.zstd.Close()
+		}
+		if errors.Is(c.stopErr, context.DeadlineExceeded) {
+			c.logger.Warn("shutdown deadline reached before the pending logs were sent", slog.Int("abandoned", lines))
+		}
+
+		c.waitGroup.Done()
+	}()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.quit:
+			return
+		case entry := <-c.entry:
+			c.add(entry)
+			if entry.sent != nil || c.full() {
+				c.dispatchBatch()
+			}
+		case req := <-c.flush:
+			c.drain()
+			if c.paused.Load() {
+				// only Close sends while paused
+				c.dispatchBatch()
+				req.done <- nil
+				continue
+			}
+			req.done <- c.sendBatch(req.ctx)
+		case <-c.tick():
+			c.dispatchBatch()
+		case update := <-c.updates:
+			update()
+		case <-c.heldReady:
+			c.dispatchHeld()
+		}
+	}
+}
+
+// full reports whether the batch reached BatchMaxSize or BatchMaxBytes, or
+// MaxBufferedBytes is exceeded with OverflowDropOldest
+func (c *Client) full() bool {
+	if c.config.BatchMaxBytes > 0 && c.batch.bytes >= c.config.BatchMaxBytes {
+		return true
+	}
+	if c.dropsOldest() && c.buffered.Load() > int64(c.config.MaxBufferedBytes) {
+		// sending or holding the batch lets the oldest lines be dropped
+		return true
+	}
+	return c.batch.len() >= c.config.BatchMaxSize
+}
+
+func (c *Client) add(entry logEntry) {
+	// label templates read the fields of the line before it is rewritten
+	labels := c.limitStreams(c.streamLabels(entry))
+	var repeatKey string
+	if c.config.CollapseRepeats {
+		repeatKey = c.repeatKey(entry)
+	}
+	queued := entry.raw
+	c.rewriteLine(&entry)
+	line := c.formatLine(&entry)
+	if truncated := truncateLine(line, c.config.MaxLineBytes); truncated != line {
+		c.truncated.Add(1)
+		line = truncated
+	}
+	if line != queued {
+		c.buffered.Add(int64(len(line) - len(queued)))
+	}
+	entry.raw = line
+
+	v := newLog(entry)
+	if max := c.config.BatchMaxBytes; max > 0 && c.batch.len() > 0 && c.batch.bytes+v.size() > max {
+		// send what we have so the batch stays below the limit
+		c.dispatchBatch()
+	}
+	c.batch.add(entry.tenant, labels, v, repeatKey)
+	c.wal.append(entry.tenant, labels, v)
+	if entry.sent != nil {
+		c.batch.waiters = append(c.batch.waiters, entry.sent)
+	}
+}
+
+// retainable reports whether the failed batch p is held to be sent again.
+// During shutdown it stays in QueueDir for the next start.
+func (c *Client) retainable(p pendingRequest, err error) bool {
+	if p.segment == "" {
+		return false
+	}
+	select {
+	case <-c.quit:
+		return false
+	default:
+	}
+	return retryable(err) || errors.Is(err, ErrCircuitOpen)
+}
+
+// rejected reports whether loki rejected a batch, so that sending it again
+// fails as well
+func rejected(err error) bool {
+	var respErr *ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode < 500 && respErr.StatusCode != http.StatusTooManyRequests
+}
+
+// retain holds the failed batch p and sends it again with the held batches
+// after a backoff that grows with its attempts
+func (c *Client) retain(p pendingRequest, err error) {
+	if c.config.OnSendError != nil {
+		c.config.OnSendError(err, p.lines)
+	}
+	for _, sent := range p.waiters {
+		sent <- err
+	}
+	p.waiters = nil
+	delay := c.backoff(p.attempts)
+	p.attempts++
+	c.requeue(p, delay)
+}
+
+// repeatKey returns the key that identical lines share for CollapseRepeats:
+// the line without its time field, and its structured metadata
+func (c *Client) repeatKey(entry logEntry) string {
+	key := entry.raw
+	if entry.fields != nil {
+		kept := make([]field, 0, len(entry.fields))
+		for _, f := range entry.fields {
+			if f.key != c.lineKeys.time {
+				kept = append(kept, f)
+			}
+		}
+		key = encodeFields(kept)
+	}
+	if len(entry.metadata) > 0 {
+		metadata, _ := json.Marshal(entry.metadata)
+		key += "\x00" + string(metadata)
+	}
+	return key
+}
+
+// drain adds the entries that are still queued in the entry channel to the
+// batch
+func (c *Client) drain() {
+	for {
+		select {
+		case entry := <-c.entry:
+			c.add(entry)
+			if c.full() {
+				c.dispatchBatch()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// pendingRequest is a batch that was taken for sending together with the
+// producers waiting for its result
+type pendingRequest struct {
+	req     lokiPushRequest
+	waiters []chan error
+	// lines is the number of log lines of the batch, including collapsed
+	// repeats
+	lines    int
+	buffered int
+	// segment is the file in QueueDir that holds the batch
+	segment string
+	// attempts is the number of times a batch in QueueDir failed
+	attempts int
+}
+
+// sendBatch waits for the requests in flight, then sends the held batches and
+// the current batch and returns the result. Once ctx is done the batches fail
+// without waiting any longer.
+func (c *Client) sendBatch(ctx context.Context) error {
+	var errs []error
+	errs = append(errs, c.waitInflight(ctx))
+	for _, p := range c.takeHeld() {
+		errs = append(errs, c.sendPending(ctx, p))
+	}
+	if c.batch.len() > 0 {
+		errs = append(errs, c.sendPending(ctx, c.takeBatch()))
+	}
+	return errors.Join(errs...)
+}
+
+// waitInflight waits for the requests in flight until ctx is done
+func (c *Client) waitInflight(ctx context.Context) error {
+	if c.inflightSlots == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pendingLines returns the number of log lines in the current batch, the held
+// batches and the requests in flight
+func (c *Client) pendingLines() int {
+	lines := c.batch.len() + int(c.inflightLines.Load())
+	c.heldMu.Lock()
+	defer c.heldMu.Unlock()
+	for _, p := range c.held {
+		lines += p.lines
+	}
+	return lines
+}
+
+// dispatchBatch sends the current batch if it is not empty. With
+// MaxInflightRequests above 1 the request is made by a separate goroutine
+// once fewer than MaxInflightRequests are in flight, so batching continues
+// while loki is slow. While paused the batch is held until Resume. Errors are
+// logged.
+func (c *Client) dispatchBatch() {
+	if c.batch.len() == 0 {
+		return
+	}
+	p := c.takeBatch()
+	if c.paused.Load() {
+		c.hold(p)
+		return
+	}
+	c.dispatch(p)
+}
+
+func (c *Client) dispatch(p pendingRequest) {
+	if c.inflightSlots == nil {
+		c.sendDispatched(p)
+		return
+	}
+
+	c.inflightSlots <- struct{}{}
+	c.inflight.Add(1)
+	c.inflightLines.Add(int64(p.lines))
+	go func() {
+		defer func() {
+			c.inflightLines.Add(int64(-p.lines))
+			<-c.inflightSlots
+			c.inflight.Done()
+		}()
+		c.sendDispatched(p)
+	}()
+}
+
+// sendDispatched sends p in the background and logs errors. Batches that loki
+// rejects because of rate limiting are requeued and sent once the limit has
+// passed.
+func (c *Client) sendDispatched(p pendingRequest) {
+	err := c.throttledSend(c.dispatchCtx, &p)
+	if delay, limited := c.rateLimited(err); limited && c.dispatchCtx.Err() == nil {
+		c.logger.Warn("loki is rate limiting, requeueing logs", slog.Int("lines", p.lines), slog.Duration("delay", delay))
+		c.requeue(p, delay)
+		return
+	}
+	c.finish(p, err)
+	c.logSendError(err)
+}
+
+// takeBatch returns the current batch for sending and starts a new batch and
+// wait interval
+func (c *Client) takeBatch() pendingRequest {
+	p := pendingRequest{
+		req:      c.batch.request(),
+		waiters:  c.batch.waiters,
+		lines:    c.batch.entries,
+		buffered: c.batch.buffered,
+		segment:  c.wal.rotate(),
+	}
+	c.batch.reset()
+	// measure the wait for the next batch from this request
+	c.resetTicker()
+	return p
+}
+
+// sendPending sends p and reports the result to the producers waiting for it
+func (c *Client) sendPending(ctx context.Context, p pendingRequest) error {
+	err := c.throttledSend(ctx, &p)
+	c.finish(p, err)
+	return err
+}
+
+// throttledSend sends p once MaxLinesPerSecond and MaxBytesPerSecond allow
+func (c *Client) throttledSend(ctx context.Context, p *pendingRequest) error {
+	if err := c.throttle(ctx, p); err != nil {
+		return err
+	}
+	if len(p.req.Streams) == 0 {
+		return nil
+	}
+	return c.send(ctx, p.req)
+}
+
+// finish releases the buffer of a batch that is done and reports its result
+// to the producers waiting for it. Failed batches are written to Fallback
+// and kept in QueueDir or as dead letters. Batches that loki rejects are
+// moved from QueueDir to the dead letters. Batches in QueueDir that may be
+// sent later are held and sent again instead.
+func (c *Client) finish(p pendingRequest, err error) {
+	if err != nil && c.retainable(p, err) {
+		c.retain(p, err)
+		return
+	}
+	c.buffered.Add(int64(-p.buffered))
+	if err == nil {
+		c.sent.Add(uint64(p.lines))
+		c.wal.remove(p.segment)
+	} else {
+		c.failed.Add(uint64(p.lines))
+		if c.config.OnSendError != nil {
+			c.config.OnSendError(err, p.lines)
+		}
+		c.writeFallback(p.req)
+		if p.segment == "" || rejected(err) {
+			// loki would reject the batch again when QueueDir is replayed
+			c.deadLetter(p.req)
+			c.wal.remove(p.segment)
+		}
+	}
+	for _, sent := range p.waiters {
+		sent <- err
+	}
+}
+
+func (c *Client) logSendError(err error) {
+	// an open circuit breaker is logged once when it opens
+	if err != nil && !errors.Is(err, ErrCircuitOpen) {
+		c.logger.Error("failed to send logs", slog.Any("error", err))
+	}
+}
+
+func newLog(entry logEntry) streamValue {
+	v := streamValue{strconv.FormatInt(entry.ts.UnixNano(), 10), entry.raw}
+	if len(entry.metadata) > 0 {
+		metadata, _ := json.Marshal(entry.metadata)
+		v = append(v, string(metadata))
+	}
+	return v
+}
+
+// epochSeconds returns t in the format used by zap's default time encoder
+func epochSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
@@ -0,0 +1,430 @@
+package zaploki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestClientPushAndFlush(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "first", nil))
+	assert.NoError(t, c.Push(ctx, "error", "second", map[string]string{"job": "cron"}))
+	assert.NoError(t, c.Flush(ctx))
+
+	req := <-received
+	assert.Len(t, req.Streams, 2, "Expected one stream per label set")
+	assert.Equal(t, map[string]string{"app": "test"}, req.Streams[0].Stream)
+	assert.Equal(t, map[string]string{"app": "test", "job": "cron"}, req.Streams[1].Stream)
+
+	var entry logEntry
+	assert.NoError(t, json.Unmarshal([]byte(req.Streams[1].Values[0][1]), &entry))
+	assert.Equal(t, "error", entry.Level)
+	assert.Equal(t, "second", entry.Message)
+}
+
+func TestClientPushAfterStop(t *testing.T) {
+	c := NewClient(context.Background(), Config{
+		Url:          "http://localhost",
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	c.Stop()
+
+	assert.ErrorIs(t, c.Push(context.Background(), "info", "late", nil), ErrStopped)
+	assert.ErrorIs(t, c.Flush(context.Background()), ErrStopped)
+}
+
+func TestClientPushDuringClose(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	for _, cfg := range []Config{
+		{Url: mockServer.URL, BatchMaxSize: 100, QueueSize: 100},
+		{Url: mockServer.URL, BatchMaxSize: 100, QueueSize: 100, FlushOnLevel: zapcore.ErrorLevel},
+	} {
+		c := NewClient(context.Background(), cfg)
+		var producers sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			producers.Add(1)
+			go func() {
+				defer producers.Done()
+				for c.Push(context.Background(), "error", "test message", nil) == nil {
+				}
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, c.Close(context.Background()))
+
+		done := make(chan struct{})
+		go func() {
+			producers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected producers to return after Close")
+		}
+		stats := c.Stats()
+		assert.Equal(t, stats.Enqueued, stats.Sent+stats.Dropped+stats.Failed, "Expected every accepted line to be sent")
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	assert.NoError(t, c.Push(context.Background(), "info", "pending", nil))
+	assert.NoError(t, c.Close(context.Background()))
+	assert.NoError(t, c.Close(context.Background()), "Expected repeated Close to be safe")
+
+	req := <-received
+	assert.Len(t, req.Streams[0].Values, 1, "Expected pending lines to be sent on close")
+}
+
+func TestClientCloseReportsError(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	assert.NoError(t, c.Push(context.Background(), "info", "pending", nil))
+	assert.Error(t, c.Close(context.Background()))
+}
+
+func TestClientImmediateMode(t *testing.T) {
+	var requests int
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		requests++
+		assert.Len(t, req.Streams[0].Values, 1, "Expected one line per request")
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    100,
+		DisableBatching: true,
+	})
+	defer c.Stop()
+
+	assert.NoError(t, c.Push(context.Background(), "info", "first", nil))
+	assert.Equal(t, 1, requests, "Expected the line to be sent before Push returns")
+	assert.NoError(t, c.Push(context.Background(), "info", "second", nil))
+	assert.Equal(t, 2, requests, "Expected the line to be sent before Push returns")
+}
+
+func TestClientFlushOnLevel(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		FlushOnLevel: zapcore.ErrorLevel,
+	})
+	defer c.Stop()
+
+	assert.NoError(t, c.Push(context.Background(), "info", "batched", nil))
+	assert.NoError(t, c.Push(context.Background(), "error", "urgent", nil))
+
+	select {
+	case req := <-received:
+		assert.Len(t, req.Streams[0].Values, 2, "Expected the whole batch to be sent")
+	default:
+		t.Fatal("Expected the error line to flush the batch")
+	}
+}
+
+func TestClientBatchMaxBytes(t *testing.T) {
+	received := make(chan lokiPushRequest, 2)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:           mockServer.URL,
+		BatchMaxSize:  100,
+		BatchMaxBytes: 250,
+		BatchMaxWait:  10 * time.Second,
+	})
+	defer c.Stop()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.Push(context.Background(), "info", "a line of roughly one hundred bytes", nil))
+	}
+	assert.NoError(t, c.Flush(context.Background()))
+
+	assert.Len(t, (<-received).Streams[0].Values, 2, "Expected the batch to be sent before exceeding the limit")
+	assert.Len(t, (<-received).Streams[0].Values, 1, "Expected the remaining line to be flushed")
+}
+
+func TestClientConcurrentFlush(t *testing.T) {
+	var mu sync.Mutex
+	var lines int
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, s := range req.Streams {
+			lines += len(s.Values)
+		}
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 10,
+		BatchMaxWait: time.Millisecond,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+				assert.NoError(t, c.Flush(context.Background()))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, c.Close(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 100, lines, "Expected every line to be sent exactly once")
+}
+
+func TestClientQueueSize(t *testing.T) {
+	release := make(chan struct{})
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		<-release
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 2,
+		BatchMaxWait: 10 * time.Second,
+		QueueSize:    10,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, c.Push(ctx, "info", "test message", nil), "Expected the queue to absorb a slow request")
+	}
+	close(release)
+	assert.NoError(t, c.Close(context.Background()))
+}
+
+func TestClientResetsWaitAfterFlush(t *testing.T) {
+	received := make(chan time.Time, 10)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- time.Now()
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 200 * time.Millisecond,
+	})
+	defer c.Stop()
+
+	time.Sleep(150 * time.Millisecond)
+	assert.NoError(t, c.Push(context.Background(), "info", "flushed", nil))
+	assert.NoError(t, c.Flush(context.Background()))
+	flushed := <-received
+
+	assert.NoError(t, c.Push(context.Background(), "info", "batched", nil))
+	ticked := <-received
+	assert.GreaterOrEqual(t, ticked.Sub(flushed), 150*time.Millisecond, "Expected the wait to restart after the flush")
+}
+
+func TestClientMaxInflightRequests(t *testing.T) {
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		started <- struct{}{}
+		<-release
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:                 mockServer.URL,
+		BatchMaxSize:        2,
+		BatchMaxWait:        10 * time.Second,
+		MaxInflightRequests: 2,
+	})
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("Expected two requests to be in flight")
+		}
+	}
+	close(release)
+	assert.NoError(t, c.Close(context.Background()))
+}
+
+func TestClientShutdownTimeout(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    100,
+		BatchMaxWait:    10 * time.Second,
+		ShutdownTimeout: 50 * time.Millisecond,
+	})
+	assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+
+	start := time.Now()
+	assert.ErrorIs(t, c.Close(context.Background()), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "Expected the shutdown to be bounded")
+}
+
+func TestClientShutdownTimeoutInflight(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(3 * time.Second):
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	var logs bytes.Buffer
+	c := NewClient(context.Background(), Config{
+		Url:                 mockServer.URL,
+		BatchMaxSize:        2,
+		BatchMaxWait:        10 * time.Second,
+		MaxInflightRequests: 2,
+		MaxRetries:          5,
+		ShutdownTimeout:     100 * time.Millisecond,
+		InternalLogger:      slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	assert.ErrorIs(t, c.Close(context.Background()), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second, "Expected the requests in flight to be bounded by the shutdown")
+	assert.Contains(t, logs.String(), "abandoned=4")
+	assert.Equal(t, uint64(4), c.Stats().Failed)
+}
+
+func TestCallbacks(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockServer.Close()
+
+	var sendErrors, failedLines, dropped atomic.Int32
+	c := NewClient(context.Background(), Config{
+		Url:              mockServer.URL,
+		BatchMaxSize:     100,
+		BatchMaxWait:     10 * time.Second,
+		MaxBufferedBytes: 200,
+		OnSendError: func(err error, batchSize int) {
+			sendErrors.Add(1)
+			failedLines.Add(int32(batchSize))
+		},
+		OnDrop: func(count int) {
+			dropped.Add(int32(count))
+		},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, c.Push(ctx, "info", "a line of roughly one hundred bytes", nil))
+	}
+	assert.Error(t, c.Flush(ctx))
+	assert.Equal(t, int32(1), sendErrors.Load())
+	assert.Equal(t, int32(2), failedLines.Load())
+	assert.Equal(t, int32(3), dropped.Load())
+}
+
+func TestInternalLogger(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockServer.Close()
+
+	before := slog.Default()
+	var buf bytes.Buffer
+	v := New(context.Background(), Config{
+		Url:            mockServer.URL,
+		BatchMaxSize:   2,
+		BatchMaxWait:   10 * time.Second,
+		InternalLogger: slog.New(slog.NewTextHandler(&buf, nil)),
+	})
+	assert.Same(t, before, slog.Default(), "Expected the default logger to be kept")
+
+	ctx := context.Background()
+	assert.NoError(t, v.PushEntry(ctx, "info", "first", nil))
+	assert.NoError(t, v.PushEntry(ctx, "info", "second", nil))
+	v.Close(ctx)
+	assert.Contains(t, buf.String(), "failed to send logs")
+}
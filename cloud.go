@@ -0,0 +1,164 @@
+package zaploki
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const cloudDetectTimeout = 500 * time.Millisecond
+
+// the metadata endpoints of the cloud providers
+var (
+	ec2MetadataURL = "http://169.254.169.254"
+	gceMetadataURL = "http://metadata.google.internal"
+)
+
+var errNoMetadata = errors.New("no metadata endpoint")
+
+// cloudLabels returns the labels of the cloud workload the process runs in,
+// using the first of ECS, Cloud Run, GCE and EC2 that answers. It returns nil
+// if none is found.
+func cloudLabels(ctx context.Context) map[string]string {
+	for _, detect := range []func(context.Context) (map[string]string, error){
+		detectECS,
+		detectCloudRun,
+		detectGCE,
+		detectEC2,
+	} {
+		if labels, err := detect(ctx); err == nil {
+			return labels
+		}
+	}
+	return nil
+}
+
+// detectECS reads the task metadata endpoint of an ECS container
+func detectECS(ctx context.Context) (map[string]string, error) {
+	uri := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	if uri == "" {
+		return nil, errNoMetadata
+	}
+	body, err := getMetadata(ctx, http.MethodGet, uri+"/task", nil)
+	if err != nil {
+		return nil, err
+	}
+	var task struct {
+		TaskARN          string
+		Cluster          string
+		AvailabilityZone string
+	}
+	if err := json.Unmarshal(body, &task); err != nil {
+		return nil, err
+	}
+	labels := map[string]string{
+		"cloud_provider": "aws",
+		"ecs_task_arn":   task.TaskARN,
+		"ecs_cluster":    task.Cluster,
+	}
+	if task.AvailabilityZone != "" {
+		labels["cloud_zone"] = task.AvailabilityZone
+		labels["cloud_region"] = strings.TrimRight(task.AvailabilityZone, "abcdefghijklmnopqrstuvwxyz")
+	}
+	return labels, nil
+}
+
+// detectCloudRun reads the environment of a Cloud Run service and its region
+// from the metadata server
+func detectCloudRun(ctx context.Context) (map[string]string, error) {
+	service := os.Getenv("K_SERVICE")
+	if service == "" {
+		return nil, errNoMetadata
+	}
+	labels := map[string]string{
+		"cloud_provider":     "gcp",
+		"cloud_run_service":  service,
+		"cloud_run_revision": os.Getenv("K_REVISION"),
+	}
+	if region, err := getGCEMetadata(ctx, "instance/region"); err == nil {
+		labels["cloud_region"] = path.Base(region)
+	}
+	return labels, nil
+}
+
+// detectGCE reads the metadata server of a GCE instance
+func detectGCE(ctx context.Context) (map[string]string, error) {
+	name, err := getGCEMetadata(ctx, "instance/name")
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{
+		"cloud_provider": "gcp",
+		"gce_instance":   name,
+	}
+	if zone, err := getGCEMetadata(ctx, "instance/zone"); err == nil {
+		zone = path.Base(zone)
+		labels["cloud_zone"] = zone
+		if i := strings.LastIndexByte(zone, '-'); i > 0 {
+			labels["cloud_region"] = zone[:i]
+		}
+	}
+	return labels, nil
+}
+
+func getGCEMetadata(ctx context.Context, key string) (string, error) {
+	body, err := getMetadata(ctx, http.MethodGet, gceMetadataURL+"/computeMetadata/v1/"+key, http.Header{"Metadata-Flavor": {"Google"}})
+	return string(body), err
+}
+
+// detectEC2 reads the instance metadata service of an EC2 instance, using a
+// session token as required by IMDSv2
+func detectEC2(ctx context.Context) (map[string]string, error) {
+	token, err := getMetadata(ctx, http.MethodPut, ec2MetadataURL+"/latest/api/token", http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"60"}})
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {string(token)}}
+	id, err := getMetadata(ctx, http.MethodGet, ec2MetadataURL+"/latest/meta-data/instance-id", header)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{
+		"cloud_provider":  "aws",
+		"ec2_instance_id": string(id),
+	}
+	if region, err := getMetadata(ctx, http.MethodGet, ec2MetadataURL+"/latest/meta-data/placement/region", header); err == nil {
+		labels["cloud_region"] = string(region)
+	}
+	if zone, err := getMetadata(ctx, http.MethodGet, ec2MetadataURL+"/latest/meta-data/placement/availability-zone", header); err == nil {
+		labels["cloud_zone"] = string(zone)
+	}
+	return labels, nil
+}
+
+// getMetadata requests a metadata endpoint and returns the body of a
+// successful response
+func getMetadata(ctx context.Context, method, url string, header http.Header) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, cloudDetectTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata endpoint answered %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return []byte(strings.TrimSpace(string(body))), err
+}
@@ -0,0 +1,75 @@
+package zaploki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log/slog"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression of JSON push requests
+type Compression int
+
+const (
+	// CompressionGzip compresses push requests with gzip
+	CompressionGzip Compression = iota
+	// CompressionZstd compresses push requests with zstd, which compresses
+	// large batches better with less CPU. Loki or the gateway in front of it
+	// must accept zstd.
+	CompressionZstd
+	// CompressionNone sends push requests uncompressed
+	CompressionNone
+)
+
+// newZstdEncoder returns nil unless Compression is zstd. Requests are
+// compressed with gzip if the encoder can't be created.
+func newZstdEncoder(cfg *Config, logger *slog.Logger) *zstd.Encoder {
+	if cfg.Compression != CompressionZstd {
+		return nil
+	}
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		logger.Error("failed to create zstd encoder, using gzip", slog.Any("error", err))
+		cfg.Compression = CompressionGzip
+		return nil
+	}
+	return enc
+}
+
+// checkGzipLevel replaces a GzipLevel that gzip doesn't support with the
+// default, so requests don't fail because of it
+func checkGzipLevel(cfg *Config, logger *slog.Logger) {
+	if cfg.GzipLevel < gzip.HuffmanOnly || cfg.GzipLevel > gzip.BestCompression {
+		logger.Error("invalid GzipLevel, using the default compression", slog.Int("level", cfg.GzipLevel))
+		cfg.GzipLevel = 0
+	}
+}
+
+// compress compresses data with Compression and returns it with its
+// Content-Encoding, which is empty if data is sent as it is
+func (c *Client) compress(data []byte) ([]byte, string, error) {
+	if c.config.Compression == CompressionNone || len(data) < c.config.CompressionThreshold {
+		return data, "", nil
+	}
+	if c.zstd != nil {
+		return c.zstd.EncodeAll(data, nil), "zstd", nil
+	}
+
+	level := c.config.GzipLevel
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := gz.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "gzip", nil
+}
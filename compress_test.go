@@ -0,0 +1,83 @@
+package zaploki
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressionZstd(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "zstd", r.Header.Get("Content-Encoding"))
+		dec, err := zstd.NewReader(r.Body)
+		assert.NoError(t, err)
+		defer dec.Close()
+		body, err := io.ReadAll(dec)
+		assert.NoError(t, err)
+		var req lokiPushRequest
+		assert.NoError(t, json.Unmarshal(body, &req))
+		received <- req
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		Compression:  CompressionZstd,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+	req := <-received
+	assert.Equal(t, "test message", parseLine([]byte(req.Streams[0].Values[0][1])).Message)
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	c := &Client{config: &Config{CompressionThreshold: 100}}
+	data, encoding, err := c.compress([]byte(`{"streams":[]}`))
+	assert.NoError(t, err)
+	assert.Empty(t, encoding, "Expected small requests to be sent uncompressed")
+	assert.Equal(t, `{"streams":[]}`, string(data))
+
+	large := []byte(strings.Repeat("a", 100))
+	_, encoding, err = c.compress(large)
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", encoding)
+
+	c = &Client{config: &Config{Compression: CompressionNone}}
+	data, encoding, err = c.compress(large)
+	assert.NoError(t, err)
+	assert.Empty(t, encoding)
+	assert.Equal(t, large, data)
+
+	headers := requestHeaders(t, Config{Compression: CompressionNone})
+	assert.Empty(t, headers.Get("Content-Encoding"))
+}
+
+func TestGzipLevel(t *testing.T) {
+	data := []byte(strings.Repeat(`{"level":"info","msg":"a repeated log line"}`, 100))
+	fast, _, err := (&Client{config: &Config{GzipLevel: gzip.BestSpeed}}).compress(data)
+	assert.NoError(t, err)
+	best, _, err := (&Client{config: &Config{GzipLevel: gzip.BestCompression}}).compress(data)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(best), len(fast))
+
+	c := NewClient(context.Background(), Config{Url: "http://localhost", GzipLevel: 42})
+	defer c.Stop()
+	_, encoding, err := c.compress(data)
+	assert.NoError(t, err, "Expected an invalid level to use the default")
+	assert.Equal(t, "gzip", encoding)
+}
@@ -0,0 +1,87 @@
+package zaploki
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// lokiCore is a zap core that encodes entries as JSON and queues them with
+// the client. Fields added with With whose keys are in LabelKeys become
+// labels of the stream instead of being encoded, so child loggers send their
+// lines in their own streams.
+type lokiCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	lp     *lokiPusher
+	labels map[string]string
+}
+
+// Core returns a zap core that sends the entries enabled by enab to loki
+func (lp *lokiPusher) Core(enab zapcore.LevelEnabler) zapcore.Core {
+	return &lokiCore{
+		LevelEnabler: enab,
+		enc:          zapcore.NewJSONEncoder(encoderConfig(lp.config)),
+		lp:           lp,
+	}
+}
+
+func (c *lokiCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &lokiCore{
+		LevelEnabler: c.LevelEnabler,
+		enc:          c.enc.Clone(),
+		lp:           c.lp,
+		labels:       c.labels,
+	}
+	for _, f := range fields {
+		if c.lp.labelKeys[f.Key] {
+			clone.labels = mergeLabels(clone.labels, map[string]string{f.Key: fieldText(f)})
+			continue
+		}
+		f.AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *lokiCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *lokiCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	entry := c.lp.lineKeys.parseLine([]byte(strings.TrimSuffix(buf.String(), "\n")))
+	buf.Free()
+	// the encoded time may be less precise than the entry
+	entry.ts = ent.Time
+	entry.labels = c.labels
+	if err := c.lp.enqueue(context.Background(), entry); err != nil {
+		return err
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		// like zap's own cores, send everything before a panic or exit
+		return c.Sync()
+	}
+	return nil
+}
+
+func (c *lokiCore) Sync() error {
+	return newSink(c.lp).Sync()
+}
+
+// fieldText returns the value of a zap field as text for a label
+func fieldText(f zapcore.Field) string {
+	if f.Type == zapcore.StringType {
+		return f.String
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+	return fmt.Sprint(enc.Fields[f.Key])
+}
@@ -0,0 +1,43 @@
+package zaploki
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCoreWithLabels(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	lp := New(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+		LabelKeys:    []string{"component"},
+	})
+	defer lp.Stop()
+
+	logger := zap.New(lp.Core(zap.InfoLevel))
+	logger.With(zap.String("component", "db"), zap.Int("shard", 1)).Info("query")
+	logger.Info("request")
+	logger.Debug("disabled")
+	assert.NoError(t, logger.Sync())
+
+	req := <-received
+	assert.Len(t, req.Streams, 2, "Expected the child logger to use its own stream")
+	assert.Equal(t, map[string]string{"app": "test", "component": "db"}, req.Streams[0].Stream)
+	line := req.Streams[0].Values[0][1]
+	assert.Equal(t, "query", parseLine([]byte(line)).Message)
+	assert.Contains(t, line, `"shard":1`)
+	assert.NotContains(t, line, "component")
+	assert.Equal(t, map[string]string{"app": "test"}, req.Streams[1].Stream)
+	assert.Len(t, req.Streams[1].Values, 1)
+}
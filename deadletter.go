@@ -0,0 +1,106 @@
+package zaploki
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// storedRequest is a push request as it is written to DeadLetterFile, with
+// the tenant of its streams
+type storedRequest struct {
+	Tenant string `json:"tenant,omitempty"`
+	lokiPushRequest
+}
+
+// deadLetter appends req to DeadLetterFile, so a batch that could not be sent
+// can be replayed later with ReplayDeadLetters. Every tenant of req gets a line
+// of its own.
+func (c *Client) deadLetter(req lokiPushRequest) {
+	if c.config.DeadLetterFile == "" {
+		return
+	}
+	var lines []byte
+	for _, r := range req.byTenant() {
+		line, err := json.Marshal(storedRequest{Tenant: r.tenant(), lokiPushRequest: r})
+		if err != nil {
+			c.logger.Error("failed to encode dead letter", slog.Any("error", err))
+			return
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	c.deadLetterMu.Lock()
+	defer c.deadLetterMu.Unlock()
+	f, err := os.OpenFile(c.config.DeadLetterFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		c.logger.Error("failed to open dead letter file", slog.Any("error", err))
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(lines); err != nil {
+		c.logger.Error("failed to write dead letter", slog.Any("error", err))
+	}
+}
+
+// ReplayDeadLetters sends the batches in DeadLetterFile to loki. Batches that
+// fail again are written back to the file and their errors returned.
+func (c *Client) ReplayDeadLetters(ctx context.Context) error {
+	reqs, err := c.takeDeadLetters()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, req := range reqs {
+		if err := c.send(ctx, req); err != nil {
+			c.deadLetter(req)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// takeDeadLetters reads and empties DeadLetterFile
+func (c *Client) takeDeadLetters() ([]lokiPushRequest, error) {
+	if c.config.DeadLetterFile == "" {
+		return nil, nil
+	}
+
+	c.deadLetterMu.Lock()
+	defer c.deadLetterMu.Unlock()
+	f, err := os.OpenFile(c.config.DeadLetterFile, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead letter file: %w", err)
+	}
+	defer f.Close()
+
+	var reqs []lokiPushRequest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var req storedRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			// keep the file as it is so nothing is lost
+			return nil, fmt.Errorf("failed to decode dead letter: %w", err)
+		}
+		for i := range req.Streams {
+			req.Streams[i].tenant = req.Tenant
+		}
+		reqs = append(reqs, req.lokiPushRequest)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dead letter file: %w", err)
+	}
+	if err := f.Truncate(0); err != nil {
+		return nil, fmt.Errorf("failed to empty dead letter file: %w", err)
+	}
+	return reqs, nil
+}
@@ -0,0 +1,56 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayDeadLetters(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	received := make(chan lokiPushRequest, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- decodePushRequest(t, r)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	file := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	c := NewClient(context.Background(), Config{
+		Url:            mockServer.URL,
+		BatchMaxSize:   100,
+		BatchMaxWait:   10 * time.Second,
+		DeadLetterFile: file,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "error", "lost during outage", nil))
+	assert.Error(t, c.Flush(ctx))
+
+	assert.Error(t, c.ReplayDeadLetters(ctx), "Expected the replay to fail while loki is down")
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "lost during outage", "Expected the failed replay to be kept")
+
+	down.Store(false)
+	assert.NoError(t, c.ReplayDeadLetters(ctx))
+	req := <-received
+	assert.Contains(t, req.Streams[0].Values[0][1], "lost during outage")
+
+	content, err = os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Empty(t, content, "Expected the replayed batches to be removed")
+}
@@ -0,0 +1,83 @@
+package zaploki
+
+import (
+	"encoding/json"
+	"errors"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// lineKeys are the keys of the fields a JSON log line is parsed from
+type lineKeys struct {
+	time, level, message, caller string
+}
+
+// defaultLineKeys are the keys of zap's production encoder config
+var defaultLineKeys = newLineKeys(nil)
+
+// newLineKeys returns the keys of cfg, or of zap's production encoder config
+// if cfg is nil
+func newLineKeys(cfg *zapcore.EncoderConfig) lineKeys {
+	if cfg == nil {
+		production := zap.NewProductionEncoderConfig()
+		cfg = &production
+	}
+	return lineKeys{time: cfg.TimeKey, level: cfg.LevelKey, message: cfg.MessageKey, caller: cfg.CallerKey}
+}
+
+// encoderConfig returns EncoderConfig, or zap's production encoder config if
+// it is not set
+func encoderConfig(cfg *Config) zapcore.EncoderConfig {
+	if cfg.EncoderConfig != nil {
+		return *cfg.EncoderConfig
+	}
+	return zap.NewProductionEncoderConfig()
+}
+
+// parseLine parses a line encoded with zap's production encoder config
+func parseLine(line []byte) logEntry {
+	return defaultLineKeys.parseLine(line)
+}
+
+// parseLine returns the entry of a JSON log line. Lines that are not JSON
+// objects are sent as is.
+func (k lineKeys) parseLine(line []byte) logEntry {
+	entry, err := k.decode(line)
+	if err != nil {
+		entry = logEntry{raw: string(line), parsed: true}
+	}
+	return entry
+}
+
+// decode returns the entry of a JSON log line, or an error if it is not a
+// JSON object. Fields that are missing or not strings are left empty.
+func (k lineKeys) decode(line []byte) (logEntry, error) {
+	raw := string(line)
+	fields, ok := parseFields(raw)
+	if !ok {
+		return logEntry{}, errNotJSON
+	}
+	entry := logEntry{
+		Level:   stringField(fields, k.level),
+		Message: stringField(fields, k.message),
+		Caller:  stringField(fields, k.caller),
+		ts:      timeField(fields, k.time),
+		raw:     raw,
+		fields:  fields,
+		parsed:  true,
+	}
+	return entry, nil
+}
+
+// errNotJSON is returned for log lines that are not JSON objects
+var errNotJSON = errors.New("log line is not a JSON object")
+
+// stringField returns the value of the string field key, or an empty string
+func stringField(fields []field, key string) string {
+	var s string
+	if value, ok := lookupField(fields, key); ok && key != "" {
+		_ = json.Unmarshal(value, &s)
+	}
+	return s
+}
@@ -0,0 +1,62 @@
+package zaploki
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseLineKeys(t *testing.T) {
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.TimeKey = "timestamp"
+	cfg.MessageKey = "message"
+	cfg.LevelKey = "severity"
+	cfg.CallerKey = ""
+	keys := newLineKeys(&cfg)
+
+	entry := keys.parseLine([]byte(`{"severity":"warn","timestamp":"2024-03-01T12:00:00.250Z","message":"disk full","caller":"main.go:1"}`))
+	assert.Equal(t, "warn", entry.Level)
+	assert.Equal(t, "disk full", entry.Message)
+	assert.Empty(t, entry.Caller, "Expected no caller without a CallerKey")
+	assert.Equal(t, time.Date(2024, 3, 1, 12, 0, 0, 250e6, time.UTC), entry.ts.UTC())
+
+	entry = keys.parseLine([]byte(`{"level":"warn","ts":1709294400.25,"msg":"disk full"}`))
+	assert.Empty(t, entry.Level, "Expected the default keys to be ignored")
+	assert.True(t, entry.ts.IsZero(), "Expected no time without the time key")
+}
+
+func TestEncoderConfig(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.TimeKey = "timestamp"
+	cfg.LevelKey = "severity"
+	cfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	v := New(context.Background(), Config{
+		Url:           mockServer.URL,
+		BatchMaxSize:  1,
+		BatchMaxWait:  10 * time.Second,
+		Labels:        map[string]string{"app": "test"},
+		LevelLabel:    "level",
+		EncoderConfig: &cfg,
+	})
+	defer v.Stop()
+
+	zap.New(v.Core(zapcore.InfoLevel)).Warn("test message")
+
+	req := <-received
+	assert.Equal(t, map[string]string{"app": "test", "level": "warn"}, req.Streams[0].Stream)
+	assert.Contains(t, req.Streams[0].Values[0][1], `"severity":"warn"`, "Expected Core to encode with the config")
+	ts, err := strconv.ParseInt(req.Streams[0].Values[0][0], 10, 64)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), time.Unix(0, ts), 5*time.Second)
+}
@@ -0,0 +1,122 @@
+package zaploki
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const defaultFailoverCooldown = 30 * time.Second
+
+// LoadBalancing decides how requests are spread across the loki endpoints
+type LoadBalancing int
+
+const (
+	// LoadBalanceFailover sends every request to the first available
+	// endpoint
+	LoadBalanceFailover LoadBalancing = iota
+	// LoadBalanceRoundRobin sends requests to the available endpoints in turn
+	LoadBalanceRoundRobin
+	// LoadBalanceLeastPending sends requests to the available endpoint with
+	// the fewest requests in flight
+	LoadBalanceLeastPending
+)
+
+// endpoint is a loki push url together with its health
+type endpoint struct {
+	url string
+	// downUntil is the time in unix nanoseconds until which the endpoint is
+	// only used if no other endpoint is available
+	downUntil atomic.Int64
+	// pending is the number of requests to the endpoint in flight
+	pending atomic.Int32
+}
+
+// pushURL returns the push api url of the loki server at u
+func pushURL(u string) string {
+	if socket, path, ok := parseUnixURL(u); ok {
+		u = "http://" + unixHost(socket) + path
+	}
+	return fmt.Sprintf("%s/loki/api/v1/push", strings.TrimSuffix(u, "/"))
+}
+
+// redactURL returns u with the password of its credentials replaced by xxxxx
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	return parsed.Redacted()
+}
+
+// newEndpoints returns the endpoints of the loki servers in cfg, the one of
+// Url first
+func newEndpoints(cfg *Config) []*endpoint {
+	urls := cfg.Urls
+	if cfg.Url != "" || len(urls) == 0 {
+		urls = append([]string{cfg.Url}, urls...)
+	}
+	endpoints := make([]*endpoint, 0, len(urls))
+	for _, u := range urls {
+		endpoints = append(endpoints, &endpoint{url: pushURL(u)})
+	}
+	return endpoints
+}
+
+// healthy reports whether the endpoint did not fail recently
+func (e *endpoint) healthy(now time.Time) bool {
+	return e.downUntil.Load() <= now.UnixNano()
+}
+
+// record updates the health of the endpoint with the result of a request
+func (e *endpoint) record(err error, cooldown time.Duration) {
+	switch {
+	case err == nil:
+		e.downUntil.Store(0)
+	case countsAsFailure(err):
+		e.downUntil.Store(time.Now().Add(cooldown).UnixNano())
+	}
+}
+
+// endpointOrder returns the endpoints in the order they are tried for a
+// request. Healthy endpoints come first, in the order of LoadBalancing, so
+// with failover requests go back to the first endpoint once it recovers.
+func (c *Client) endpointOrder() []*endpoint {
+	if len(c.endpoints) == 1 {
+		return c.endpoints
+	}
+	order := make([]*endpoint, len(c.endpoints))
+	switch c.config.LoadBalancing {
+	case LoadBalanceRoundRobin:
+		start := int(c.nextEndpoint.Add(1) % uint64(len(c.endpoints)))
+		n := copy(order, c.endpoints[start:])
+		copy(order[n:], c.endpoints[:start])
+	default:
+		copy(order, c.endpoints)
+	}
+
+	now := time.Now()
+	leastPending := c.config.LoadBalancing == LoadBalanceLeastPending
+	sort.SliceStable(order, func(i, j int) bool {
+		hi, hj := order[i].healthy(now), order[j].healthy(now)
+		if hi && hj && leastPending {
+			return order[i].pending.Load() < order[j].pending.Load()
+		}
+		if hi || hj {
+			return hi && !hj
+		}
+		// try the endpoint that is expected to recover first
+		return order[i].downUntil.Load() < order[j].downUntil.Load()
+	})
+	return order
+}
+
+func (c *Client) failoverCooldown() time.Duration {
+	if c.config.FailoverCooldown > 0 {
+		return c.config.FailoverCooldown
+	}
+	return defaultFailoverCooldown
+}
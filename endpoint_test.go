@@ -0,0 +1,134 @@
+package zaploki
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailover(t *testing.T) {
+	var primaryDown atomic.Bool
+	primaryDown.Store(true)
+	var primaryHits, secondaryHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		if primaryDown.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryHits.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer secondary.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:              primary.URL,
+		Urls:             []string{secondary.URL},
+		FailoverCooldown: 50 * time.Millisecond,
+		BatchMaxSize:     100,
+		BatchMaxWait:     10 * time.Second,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "first", nil))
+	assert.NoError(t, c.Flush(ctx), "Expected the request to fail over")
+	assert.Equal(t, int32(1), primaryHits.Load())
+	assert.Equal(t, int32(1), secondaryHits.Load())
+
+	assert.NoError(t, c.Push(ctx, "info", "second", nil))
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, int32(1), primaryHits.Load(), "Expected the failed endpoint to be skipped")
+	assert.Equal(t, int32(2), secondaryHits.Load())
+
+	primaryDown.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, c.Push(ctx, "info", "third", nil))
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, int32(2), primaryHits.Load(), "Expected requests to fail back")
+	assert.Equal(t, int32(2), secondaryHits.Load())
+}
+
+func TestRoundRobin(t *testing.T) {
+	var hits [3]atomic.Int32
+	urls := make([]string, 0, len(hits))
+	for i := range hits {
+		hit := &hits[i]
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hit.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer s.Close()
+		urls = append(urls, s.URL)
+	}
+
+	c := NewClient(context.Background(), Config{
+		Urls:          urls,
+		LoadBalancing: LoadBalanceRoundRobin,
+		BatchMaxSize:  100,
+		BatchMaxWait:  10 * time.Second,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+		assert.NoError(t, c.Flush(ctx))
+	}
+	for i := range hits {
+		assert.Equal(t, int32(2), hits[i].Load(), "Expected requests to be spread evenly")
+	}
+}
+
+func TestLeastPending(t *testing.T) {
+	c := &Client{
+		config:    &Config{LoadBalancing: LoadBalanceLeastPending},
+		endpoints: []*endpoint{{url: "busy"}, {url: "idle"}},
+	}
+	c.endpoints[0].pending.Store(3)
+	assert.Equal(t, "idle", c.endpointOrder()[0].url)
+}
+
+func TestHedging(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the canceled request is only noticed once the body is read
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer slow.Close()
+	received := make(chan lokiPushRequest, 1)
+	fast := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer fast.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          slow.URL,
+		Urls:         []string{fast.URL},
+		HedgeDelay:   20 * time.Millisecond,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	start := time.Now()
+	assert.NoError(t, c.Flush(ctx))
+	assert.Less(t, time.Since(start), time.Second, "Expected the hedged request to answer first")
+	assert.Contains(t, (<-received).Streams[0].Values[0][1], "test message")
+}
@@ -0,0 +1,31 @@
+package zaploki
+
+import (
+	"log/slog"
+)
+
+// writeFallback writes the lines of a batch that could not be sent to
+// Fallback as they were encoded, one per line
+func (c *Client) writeFallback(req lokiPushRequest) {
+	if c.config.Fallback == nil {
+		return
+	}
+
+	c.fallbackMu.Lock()
+	defer c.fallbackMu.Unlock()
+	for _, s := range req.Streams {
+		for _, v := range s.Values {
+			line := v[1]
+			if len(line) == 0 || line[len(line)-1] != '\n' {
+				line += "\n"
+			}
+			if _, err := c.config.Fallback.Write([]byte(line)); err != nil {
+				c.logger.Error("failed to write logs to fallback", slog.Any("error", err))
+				return
+			}
+		}
+	}
+	if err := c.config.Fallback.Sync(); err != nil {
+		c.logger.Debug("failed to sync fallback", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,40 @@
+package zaploki
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFallback(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockServer.Close()
+
+	var buf bytes.Buffer
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Fallback:     zapcore.AddSync(&buf),
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "error", "first", map[string]any{"user": "bob"}))
+	assert.NoError(t, c.Push(ctx, "error", "second", nil))
+	assert.Error(t, c.Flush(ctx))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2, "Expected one line per log line")
+	assert.Contains(t, string(lines[0]), `"msg":"first"`)
+	assert.Contains(t, string(lines[0]), `"user":"bob"`)
+	assert.Contains(t, string(lines[1]), `"msg":"second"`)
+}
@@ -0,0 +1,152 @@
+package zaploki
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// field is a top level key of a JSON encoded log line with its encoded value
+type field struct {
+	key   string
+	value json.RawMessage
+}
+
+// parseFields splits a JSON object into its top level fields, keeping their
+// order. It returns false if raw is not a JSON object. The values share the
+// memory of one copy of raw.
+func parseFields(raw string) ([]field, bool) {
+	b := []byte(raw)
+	if !json.Valid(b) {
+		return nil, false
+	}
+	i := skipSpace(b, 0)
+	if b[i] != '{' {
+		return nil, false
+	}
+	// not nil for an empty object, since nil fields mean that a line is no
+	// JSON object
+	fields := make([]field, 0, 8)
+	i = skipSpace(b, i+1)
+	for b[i] != '}' {
+		end := valueEnd(b, i)
+		var key string
+		if k := b[i+1 : end-1]; bytes.IndexByte(k, '\\') < 0 && utf8.Valid(k) {
+			key = string(k)
+		} else {
+			// escapes and invalid characters are decoded like encoding/json
+			_ = json.Unmarshal(b[i:end], &key)
+		}
+		// valid JSON has a colon after the key
+		start := skipSpace(b, skipSpace(b, end)+1)
+		end = valueEnd(b, start)
+		fields = append(fields, field{key: key, value: b[start:end:end]})
+		if i = skipSpace(b, end); b[i] == ',' {
+			i = skipSpace(b, i+1)
+		}
+	}
+	return fields, true
+}
+
+// skipSpace returns the index of the first byte from i on that is not JSON
+// whitespace
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\n' || b[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// valueEnd returns the index after the JSON value that starts at i. b must
+// be valid JSON.
+func valueEnd(b []byte, i int) int {
+	switch b[i] {
+	case '"':
+		for i++; b[i] != '"'; i++ {
+			if b[i] == '\\' {
+				i++
+			}
+		}
+		return i + 1
+	case '{', '[':
+		depth := 0
+		for ; ; i++ {
+			switch b[i] {
+			case '"':
+				i = valueEnd(b, i) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+	}
+	// numbers, booleans and null
+	for ; i < len(b); i++ {
+		switch b[i] {
+		case ',', '}', ']', ' ', '\t', '\n', '\r':
+			return i
+		}
+	}
+	return i
+}
+
+// encodeFields renders fields as a JSON object
+func encodeFields(fields []field) string {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(f.value)
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// text returns the value of a field as plain text, without the quotes of
+// strings
+func (f field) text() string {
+	var s string
+	if err := json.Unmarshal(f.value, &s); err == nil {
+		return s
+	}
+	return string(f.value)
+}
+
+// lookupField returns the value of the field key, and false if fields don't
+// have it
+func lookupField(fields []field, key string) (json.RawMessage, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f.value, true
+		}
+	}
+	return nil, false
+}
+
+// parse splits the JSON line of entry into its fields, unless that was done
+// already. All processing of the line works on the fields, which are
+// encoded once when the line is added to a batch.
+func (e *logEntry) parse() {
+	if !e.parsed {
+		e.fields, _ = parseFields(e.raw)
+		e.parsed = true
+	}
+}
+
+// line returns the log line of entry, encoding its fields if they were
+// changed
+func (e *logEntry) line() string {
+	if e.edited {
+		e.raw = encodeFields(e.fields)
+		e.edited = false
+	}
+	return e.raw
+}
@@ -0,0 +1,52 @@
+package zaploki
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// NewGrafanaCloud creates a pusher for Grafana Cloud Logs. stackURL is the
+// url of the logs data source of the stack, e.g.
+// https://logs-prod-012.grafana.net, userID its numeric user and apiKey an
+// access policy token with the logs:write scope. Batching settings of cfg
+// that are left at zero get defaults that suit Grafana Cloud.
+func NewGrafanaCloud(ctx context.Context, stackURL, userID, apiKey string, cfg Config) ZapLoki {
+	cfg.Url = grafanaCloudURL(stackURL)
+	cfg.Username = userID
+	cfg.Password = apiKey
+	if cfg.BatchMaxSize == 0 {
+		cfg.BatchMaxSize = 1000
+	}
+	if cfg.BatchMaxBytes == 0 {
+		cfg.BatchMaxBytes = 1 << 20
+	}
+	if cfg.BatchMaxWait == 0 {
+		cfg.BatchMaxWait = time.Second
+	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = 10000
+	}
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = 10 * time.Second
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 10
+	}
+	return New(ctx, cfg)
+}
+
+// grafanaCloudURL returns the base url of a Grafana Cloud logs stack. The
+// push path, which is often copied with it, is removed since it is added when
+// the requests are sent.
+func grafanaCloudURL(stackURL string) string {
+	u := strings.TrimSpace(stackURL)
+	if !strings.Contains(u, "://") {
+		u = "https://" + u
+	}
+	u = strings.TrimSuffix(u, "/")
+	for _, suffix := range []string{"/loki/api/v1/push", "/api/prom/push"} {
+		u = strings.TrimSuffix(u, suffix)
+	}
+	return strings.TrimSuffix(u, "/")
+}
@@ -0,0 +1,45 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrafanaCloudURL(t *testing.T) {
+	for _, u := range []string{
+		"https://logs-prod-012.grafana.net",
+		"https://logs-prod-012.grafana.net/",
+		"logs-prod-012.grafana.net",
+		"https://logs-prod-012.grafana.net/loki/api/v1/push",
+		" https://logs-prod-012.grafana.net/loki/api/v1/push/ ",
+	} {
+		assert.Equal(t, "https://logs-prod-012.grafana.net", grafanaCloudURL(u), u)
+	}
+}
+
+func TestNewGrafanaCloud(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	lp := NewGrafanaCloud(context.Background(), mockServer.URL+"/loki/api/v1/push", "123456", "glc_token", Config{BatchMaxWait: time.Minute})
+	defer lp.Stop()
+	c := lp.(*lokiPusher).Client
+	assert.Equal(t, 1000, c.config.BatchMaxSize)
+	assert.Equal(t, time.Minute, c.config.BatchMaxWait, "Expected configured settings to be kept")
+
+	assert.NoError(t, lp.CheckConnection(context.Background()))
+	r := <-requests
+	assert.Equal(t, "/loki/api/v1/push", r.URL.Path)
+	user, pass, _ := r.BasicAuth()
+	assert.Equal(t, "123456", user)
+	assert.Equal(t, "glc_token", pass)
+}
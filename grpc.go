@@ -0,0 +1,147 @@
+package zaploki
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcPushMethod is the push method of the loki distributor
+const grpcPushMethod = "/logproto.Pusher/Push"
+
+// rawCodec sends messages that are already encoded as protobuf
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	*v.(*[]byte) = data
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// dialGRPC returns the connection to GRPCAddress, or nil if it is not set.
+// Requests are sent over HTTP with SigV4, which can't sign gRPC requests.
+func dialGRPC(cfg *Config, logger *slog.Logger) *grpc.ClientConn {
+	if cfg.GRPCAddress == "" {
+		return nil
+	}
+	if cfg.SigV4 != nil {
+		logger.Error("SigV4 can't sign grpc requests, pushing to Url instead of GRPCAddress")
+		return nil
+	}
+
+	creds := insecure.NewCredentials()
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.build()
+		if err != nil {
+			logger.Error("invalid TLS config", slog.Any("error", err))
+		} else {
+			creds = credentials.NewTLS(tlsConfig)
+		}
+	}
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithUserAgent(userAgent),
+	}
+	if cfg.GRPCKeepalive > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.GRPCKeepalive,
+			PermitWithoutStream: true,
+		}))
+	}
+
+	conn, err := grpc.NewClient(cfg.GRPCAddress, opts...)
+	if err != nil {
+		logger.Error("invalid grpc address", slog.Any("error", err))
+		return nil
+	}
+	return conn
+}
+
+// pushGRPC sends req to the distributor at GRPCAddress
+func (c *Client) pushGRPC(ctx context.Context, req lokiPushRequest) error {
+	if c.config.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.RequestTimeout)
+		defer cancel()
+	}
+
+	// the tenant and credentials are sent as metadata like HTTP headers
+	headers, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+c.config.GRPCAddress, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := c.setHeaders(headers, req.tenant()); err != nil {
+		return err
+	}
+	md := metadata.MD{}
+	for k, v := range headers.Header {
+		if k != "User-Agent" {
+			md[strings.ToLower(k)] = v
+		}
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	body := marshalPushRequest(req)
+	var resp []byte
+	err = c.grpc.Invoke(ctx, grpcPushMethod, &body, &resp, grpc.ForceCodec(rawCodec{}))
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("failed to send request: %w", ctx.Err())
+	}
+	return grpcError(err)
+}
+
+// grpcError converts the status of a failed push to a ResponseError, so it is
+// retried like the HTTP status. Loki answers with the HTTP status as the code.
+func grpcError(err error) error {
+	st, ok := status.FromError(err)
+	if err == nil || !ok {
+		return err
+	}
+	code := int(st.Code())
+	if code < 100 || code > 599 {
+		switch st.Code() {
+		case codes.InvalidArgument:
+			code = http.StatusBadRequest
+		case codes.Unauthenticated:
+			code = http.StatusUnauthorized
+		case codes.PermissionDenied:
+			code = http.StatusForbidden
+		case codes.ResourceExhausted:
+			code = http.StatusTooManyRequests
+		case codes.Unavailable:
+			code = http.StatusServiceUnavailable
+		case codes.DeadlineExceeded:
+			code = http.StatusGatewayTimeout
+		case codes.Unimplemented:
+			code = http.StatusNotImplemented
+		default:
+			code = http.StatusInternalServerError
+		}
+	}
+	return &ResponseError{
+		StatusCode: code,
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		Body:       st.Message(),
+	}
+}
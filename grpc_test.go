@@ -0,0 +1,94 @@
+package zaploki
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer serves the loki push method with handle
+func grpcServer(t *testing.T, handle func(ctx context.Context, body []byte) error) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}))
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "logproto.Pusher",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Push",
+			Handler: func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				var body []byte
+				if err := dec(&body); err != nil {
+					return nil, err
+				}
+				resp := []byte{}
+				return &resp, handle(ctx, body)
+			},
+		}},
+	}, nil)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func TestGRPCPush(t *testing.T) {
+	received := make(chan []byte, 1)
+	addr := grpcServer(t, func(ctx context.Context, body []byte) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		assert.Equal(t, []string{"team-a"}, md.Get("x-scope-orgid"))
+		assert.Equal(t, []string{"Bearer token"}, md.Get("authorization"))
+		received <- body
+		return nil
+	})
+
+	c := NewClient(context.Background(), Config{
+		GRPCAddress:  addr,
+		BatchMaxSize: 100,
+		TenantID:     "team-a",
+		BearerToken:  "token",
+		Labels:       map[string]string{"app": "test"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	stream := protoFields(t, protoFields(t, <-received)[1][0])
+	assert.Equal(t, `{app="test"}`, string(stream[1][0]))
+	line := string(protoFields(t, stream[2][0])[2][0])
+	assert.Equal(t, "test message", parseLine([]byte(line)).Message)
+}
+
+func TestGRPCErrors(t *testing.T) {
+	addr := grpcServer(t, func(ctx context.Context, body []byte) error {
+		return status.Error(codes.Code(http.StatusTooManyRequests), "ingestion rate limit exceeded")
+	})
+
+	c := NewClient(context.Background(), Config{GRPCAddress: addr})
+	defer c.Stop()
+
+	var respErr *ResponseError
+	assert.ErrorAs(t, c.CheckConnection(context.Background()), &respErr)
+	assert.Equal(t, http.StatusTooManyRequests, respErr.StatusCode)
+	assert.Equal(t, "ingestion rate limit exceeded", respErr.Body)
+
+	assert.Equal(t, http.StatusServiceUnavailable, grpcError(status.Error(codes.Unavailable, "")).(*ResponseError).StatusCode)
+}
+
+func TestGRPCWithSigV4(t *testing.T) {
+	c := NewClient(context.Background(), Config{
+		Url:         "http://localhost",
+		GRPCAddress: "localhost:9095",
+		SigV4:       &SigV4{Region: "us-east-1", AccessKeyID: "key", SecretAccessKey: "secret"},
+	})
+	defer c.Stop()
+	assert.Nil(t, c.grpc, "Expected requests that are signed to be sent over HTTP")
+}
@@ -0,0 +1,28 @@
+package zaploki
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// hashFields replaces the values of HashFields in the JSON log line of entry
+// with their HMAC-SHA256 keyed by HashSalt, so equal values still have equal
+// hashes. Strings are hashed without their quotes.
+func (c *Client) hashFields(entry *logEntry) {
+	for i, f := range entry.fields {
+		if !c.hashKeys[f.key] || string(f.value) == "null" {
+			continue
+		}
+		entry.fields[i].value, _ = json.Marshal(c.hash(f.text()))
+		entry.edited = true
+	}
+}
+
+// hash returns the HMAC-SHA256 of value keyed by HashSalt
+func (c *Client) hash(value string) string {
+	mac := hmac.New(sha256.New, []byte(c.config.HashSalt))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
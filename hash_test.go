@@ -0,0 +1,99 @@
+package zaploki
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestHashFields(t *testing.T) {
+	c := &Client{config: &Config{HashSalt: "secret"}, hashKeys: keySet([]string{"user_id", "ip"})}
+	hashFields := func(line string) string {
+		entry := parseLine([]byte(line))
+		c.hashFields(&entry)
+		return entry.line()
+	}
+
+	var first, second, other map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(hashFields(`{"msg":"login","user_id":42,"ip":"10.0.0.1"}`)), &first))
+	assert.NoError(t, json.Unmarshal([]byte(hashFields(`{"msg":"logout","user_id":"42","ip":null}`)), &second))
+	assert.Equal(t, "login", first["msg"])
+	assert.Len(t, first["user_id"], 64)
+	assert.NotContains(t, first["ip"], "10.0.0.1")
+	assert.Equal(t, first["user_id"], second["user_id"], "Expected equal values to have equal hashes")
+	assert.Nil(t, second["ip"], "Expected null not to be hashed")
+
+	c.config.HashSalt = "other"
+	assert.NoError(t, json.Unmarshal([]byte(hashFields(`{"user_id":42}`)), &other))
+	assert.NotEqual(t, first["user_id"], other["user_id"], "Expected the salt to change the hash")
+
+	assert.Equal(t, "not json", hashFields("not json"))
+}
+
+func TestHashFieldsBeforeLabels(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+		LabelKeys:    []string{"user_id"},
+		HashFields:   []string{"user_id"},
+		HashSalt:     "secret",
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "login", map[string]any{"user_id": 42}))
+	assert.NoError(t, c.Flush(ctx))
+
+	req := <-received
+	assert.Len(t, req.Streams[0].Stream["user_id"], 64, "Expected the label to hold the hash")
+}
+
+func TestHashLabelsOfWithAndPush(t *testing.T) {
+	received := make(chan lokiPushRequest, 2)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	lp := New(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+		LabelKeys:    []string{"user_id", "email"},
+		HashFields:   []string{"user_id"},
+		HashSalt:     "secret",
+		RedactFields: []string{"email"},
+	})
+	defer lp.Stop()
+
+	logger := zap.New(lp.Core(zap.InfoLevel))
+	logger.With(zap.String("user_id", "42"), zap.String("email", "jane@example.com")).Info("login")
+	assert.NoError(t, logger.Sync())
+	c := lp.(*lokiPusher).Client
+	assert.NoError(t, c.Push(context.Background(), "info", "logout", map[string]string{"user_id": "42"}))
+	assert.NoError(t, c.Flush(context.Background()))
+
+	var streams []map[string]string
+	for len(streams) < 2 {
+		for _, s := range (<-received).Streams {
+			streams = append(streams, s.Stream)
+		}
+	}
+	hashed := streams[0]["user_id"]
+	assert.Len(t, hashed, 64, "Expected the label of With to hold the hash")
+	assert.Equal(t, defaultRedactReplacement, streams[0]["email"])
+	assert.Equal(t, hashed, streams[1]["user_id"], "Expected the label of Push to hold the same hash")
+}
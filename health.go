@@ -0,0 +1,71 @@
+package zaploki
+
+import (
+	"sync"
+	"time"
+)
+
+// Status describes the state of the log shipping to loki
+type Status struct {
+	// LastPushOK reports whether the last request to loki succeeded. It is
+	// true before the first request.
+	LastPushOK bool
+	// LastError is the error of the last failed request
+	LastError error
+	// LastErrorTime is the time of the last failed request
+	LastErrorTime time.Time
+	// LastSuccess is the time of the last successful request
+	LastSuccess time.Time
+	// QueueDepth is the number of log lines waiting to be batched
+	QueueDepth int
+	// HeldBatches is the number of batches held while paused or rate limited
+	HeldBatches int
+	// BufferedBytes is the size of the log lines that were not sent yet
+	BufferedBytes int64
+	// Dropped is the number of log lines that were dropped
+	Dropped uint64
+}
+
+// health records the results of the requests to loki
+type health struct {
+	mu            sync.Mutex
+	failed        bool
+	lastError     error
+	lastErrorTime time.Time
+	lastSuccess   time.Time
+}
+
+func (h *health) record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		h.failed = false
+		h.lastSuccess = time.Now()
+		return
+	}
+	h.failed = true
+	h.lastError = err
+	h.lastErrorTime = time.Now()
+}
+
+// Health returns the current state of the client, e.g. for a readiness
+// endpoint
+func (c *Client) Health() Status {
+	c.health.mu.Lock()
+	s := Status{
+		LastPushOK:    !c.health.failed,
+		LastError:     c.health.lastError,
+		LastErrorTime: c.health.lastErrorTime,
+		LastSuccess:   c.health.lastSuccess,
+	}
+	c.health.mu.Unlock()
+
+	c.heldMu.Lock()
+	s.HeldBatches = len(c.held)
+	c.heldMu.Unlock()
+
+	s.QueueDepth = len(c.entry)
+	s.BufferedBytes = c.buffered.Load()
+	s.Dropped = c.Dropped()
+	return s
+}
@@ -0,0 +1,48 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	var down atomic.Bool
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.True(t, c.Health().LastPushOK)
+
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+	status := c.Health()
+	assert.True(t, status.LastPushOK)
+	assert.False(t, status.LastSuccess.IsZero())
+	assert.Zero(t, status.BufferedBytes)
+
+	down.Store(true)
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.Error(t, c.Flush(ctx))
+	status = c.Health()
+	assert.False(t, status.LastPushOK)
+	assert.Error(t, status.LastError)
+}
@@ -0,0 +1,54 @@
+package zaploki
+
+import (
+	"context"
+	"time"
+)
+
+// postHedged sends body to the first endpoint of order and, if it hasn't
+// answered after HedgeDelay, also to the next one. The first success is
+// returned and the other request canceled. Endpoints that fail are followed
+// by the next endpoint like without hedging.
+func (c *Client) postHedged(ctx context.Context, order []*endpoint, tenant string, body pushBody) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan error, len(order))
+	next, running := 0, 0
+	start := func() {
+		e := order[next]
+		next++
+		running++
+		go func() {
+			e.pending.Add(1)
+			err := c.postTo(ctx, e.url, tenant, body)
+			e.pending.Add(-1)
+			e.record(err, c.failoverCooldown())
+			results <- err
+		}()
+	}
+
+	start()
+	hedge := time.NewTimer(c.config.HedgeDelay)
+	defer hedge.Stop()
+
+	var err error
+	for {
+		select {
+		case err = <-results:
+			running--
+			if !countsAsFailure(err) || ctx.Err() != nil {
+				return err
+			}
+			if next < len(order) {
+				start()
+			} else if running == 0 {
+				return err
+			}
+		case <-hedge.C:
+			if next < len(order) {
+				start()
+			}
+		}
+	}
+}
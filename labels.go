@@ -0,0 +1,157 @@
+package zaploki
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sort"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// prepare applies the configured processing of log lines to the fields of
+// entry before it is queued
+func (c *Client) prepare(entry logEntry) logEntry {
+	if c.redacting() || len(c.hashKeys) > 0 {
+		// before the fields are moved to labels and metadata
+		entry = c.scrub(entry)
+	}
+	if len(c.staticFields) > 0 {
+		entry.addFields(c.staticFields)
+	}
+	if len(c.labelKeys) > 0 {
+		entry.labels = mergeLabels(entry.labels, entry.takeFields(c.labelKeys))
+	}
+	if len(c.metadataKeys) > 0 {
+		entry.metadata = entry.takeFields(c.metadataKeys)
+	}
+	if c.config.TenantField != "" {
+		tenant := entry.takeFields(map[string]bool{c.config.TenantField: true})
+		entry.tenant = tenant[c.config.TenantField]
+	}
+	if len(c.config.LevelMapping) > 0 {
+		entry = c.mapLevel(entry)
+	}
+	if c.config.LevelLabel != "" {
+		level := entry.Level
+		if level == "" {
+			// lines that are not JSON have no level
+			level = "unknown"
+		}
+		entry.labels = mergeLabels(entry.labels, map[string]string{c.config.LevelLabel: level})
+	}
+	return entry
+}
+
+// mapLevel renames the level of entry with LevelMapping, in the level field
+// of the line as well
+func (c *Client) mapLevel(entry logEntry) logEntry {
+	level, err := zapcore.ParseLevel(entry.Level)
+	if err != nil {
+		return entry
+	}
+	name, ok := c.config.LevelMapping[level]
+	if !ok {
+		return entry
+	}
+	entry.Level = name
+	entry.setField(c.lineKeys.level, name)
+	return entry
+}
+
+// traceMetadataKeys are the fields besides the caller that TraceMetadata
+// sends as structured metadata
+var traceMetadataKeys = []string{"trace_id", "span_id"}
+
+// metadataKeys returns the fields of cfg that are sent as structured metadata
+func metadataKeys(cfg *Config) []string {
+	if !cfg.TraceMetadata {
+		return cfg.MetadataKeys
+	}
+	keys := append(append([]string{}, cfg.MetadataKeys...), traceMetadataKeys...)
+	if caller := newLineKeys(cfg.EncoderConfig).caller; caller != "" {
+		keys = append(keys, caller)
+	}
+	return keys
+}
+
+// takeFields removes the fields with the given keys from the JSON line of
+// entry and returns them as text
+func (e *logEntry) takeFields(keys map[string]bool) map[string]string {
+	var taken map[string]string
+	kept := e.fields[:0]
+	for _, f := range e.fields {
+		if !keys[f.key] {
+			kept = append(kept, f)
+			continue
+		}
+		if taken == nil {
+			taken = make(map[string]string)
+		}
+		taken[f.key] = f.text()
+	}
+	if taken != nil {
+		e.fields = kept
+		e.edited = true
+	}
+	return taken
+}
+
+// addFields adds the fields that the JSON line of entry doesn't have yet
+func (e *logEntry) addFields(extra []field) {
+	if e.fields == nil {
+		return
+	}
+	for _, f := range extra {
+		if _, ok := lookupField(e.fields, f.key); !ok {
+			e.fields = append(e.fields, f)
+			e.edited = true
+		}
+	}
+}
+
+// setField replaces the value of a field that the JSON line of entry has
+func (e *logEntry) setField(key string, value any) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	for i := range e.fields {
+		if e.fields[i].key == key {
+			e.fields[i].value = encoded
+			e.edited = true
+			return
+		}
+	}
+}
+
+// encodeStaticFields encodes StaticFields in key order
+func (c *Client) encodeStaticFields() []field {
+	keys := make([]string, 0, len(c.config.StaticFields))
+	for k := range c.config.StaticFields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := make([]field, 0, len(keys))
+	for _, k := range keys {
+		value, err := json.Marshal(c.config.StaticFields[k])
+		if err != nil {
+			c.logger.Error("failed to encode static field", slog.String("field", k), slog.Any("error", err))
+			continue
+		}
+		fields = append(fields, field{key: k, value: value})
+	}
+	return fields
+}
+
+// keySet returns keys as a set for lookups
+func keySet(keys []string) map[string]bool {
+	if len(keys) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
@@ -0,0 +1,253 @@
+package zaploki
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLabelKeys(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	v := New(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+		LabelKeys:    []string{"tenant", "component"},
+	})
+	defer v.Stop()
+
+	cfg := zap.NewProductionConfig()
+	cfg.OutputPaths = nil
+	logger, err := v.WithCreateLogger(cfg)
+	assert.NoError(t, err)
+	logger.Info("first", zap.String("tenant", "a"), zap.Int("user", 1))
+	logger.Info("second", zap.String("tenant", "b"), zap.String("component", "db"))
+	assert.NoError(t, v.Flush(context.Background()))
+
+	req := <-received
+	assert.Len(t, req.Streams, 2, "Expected one stream per label set")
+	assert.Equal(t, map[string]string{"app": "test", "tenant": "a"}, req.Streams[0].Stream)
+	assert.Equal(t, map[string]string{"app": "test", "tenant": "b", "component": "db"}, req.Streams[1].Stream)
+	assert.NotContains(t, req.Streams[0].Values[0][1], "tenant")
+	assert.Contains(t, req.Streams[0].Values[0][1], `"user":1`)
+	assert.NotContains(t, req.Streams[1].Values[0][1], "component")
+}
+
+func TestParseFields(t *testing.T) {
+	fields, ok := parseFields(`{"level":"info","msg":"test","nested":{"a":[1,2]},"n":1.5}` + "\n")
+	assert.True(t, ok)
+	assert.Equal(t, `{"level":"info","msg":"test","nested":{"a":[1,2]},"n":1.5}`, encodeFields(fields))
+	assert.Equal(t, "test", fields[1].text())
+	assert.Equal(t, "1.5", fields[3].text())
+
+	fields, ok = parseFields(` { "a\"b" : "}]" , "c":[{"d":"\"{"}] ,"e":-1e3 } `)
+	assert.True(t, ok)
+	assert.Equal(t, []field{
+		{key: `a"b`, value: json.RawMessage(`"}]"`)},
+		{key: "c", value: json.RawMessage(`[{"d":"\"{"}]`)},
+		{key: "e", value: json.RawMessage(`-1e3`)},
+	}, fields)
+
+	fields, ok = parseFields(`{}`)
+	assert.True(t, ok)
+	assert.NotNil(t, fields, "Expected an empty object to have fields")
+
+	for _, raw := range []string{"not json", `["a"]`, `{"a":1} {"b":2}`, `{"a":}`} {
+		_, ok = parseFields(raw)
+		assert.False(t, ok, raw)
+	}
+}
+
+func TestLevelLabel(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+		LevelLabel:   "level",
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "first", nil))
+	assert.NoError(t, c.Push(ctx, "error", "second", nil))
+	assert.NoError(t, c.Push(ctx, "info", "third", nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	req := <-received
+	assert.Len(t, req.Streams, 2, "Expected one stream per level")
+	assert.Equal(t, map[string]string{"app": "test", "level": "info"}, req.Streams[0].Stream)
+	assert.Len(t, req.Streams[0].Values, 2)
+	assert.Equal(t, map[string]string{"app": "test", "level": "error"}, req.Streams[1].Stream)
+}
+
+func TestLevelMapping(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+		LevelLabel:   "level",
+		LevelMapping: map[zapcore.Level]string{
+			zapcore.WarnLevel:   "warning",
+			zapcore.DPanicLevel: "critical",
+		},
+		FlushOnLevel: zapcore.WarnLevel,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "warn", "mapped", nil))
+
+	req := <-received
+	assert.Len(t, req.Streams, 1)
+	assert.Equal(t, map[string]string{"app": "test", "level": "warning"}, req.Streams[0].Stream)
+	assert.Equal(t, "warning", parseLine([]byte(req.Streams[0].Values[0][1])).Level)
+}
+
+func TestMetadataKeys(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		MetadataKeys: []string{"trace_id"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "first", map[string]any{"trace_id": "abc", "user": "bob"}))
+	assert.NoError(t, c.Push(ctx, "info", "second", nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	values := (<-received).Streams[0].Values
+	assert.Len(t, values[0], 3, "Expected structured metadata")
+	assert.JSONEq(t, `{"trace_id":"abc"}`, values[0][2])
+	assert.NotContains(t, values[0][1], "trace_id")
+	assert.Contains(t, values[0][1], `"user":"bob"`)
+	assert.Len(t, values[1], 2, "Expected no metadata for lines without the fields")
+}
+
+func TestStreamValueJSON(t *testing.T) {
+	raw, err := json.Marshal(streamValue{"1", "line", `{"trace_id":"abc"}`})
+	assert.NoError(t, err)
+	assert.Equal(t, `["1","line",{"trace_id":"abc"}]`, string(raw))
+
+	var v streamValue
+	assert.NoError(t, json.Unmarshal(raw, &v))
+	assert.Equal(t, streamValue{"1", "line", `{"trace_id":"abc"}`}, v)
+}
+
+func TestTraceMetadata(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	v := New(context.Background(), Config{
+		Url:           mockServer.URL,
+		BatchMaxSize:  100,
+		BatchMaxWait:  10 * time.Second,
+		TraceMetadata: true,
+	})
+	defer v.Stop()
+
+	cfg := zap.NewProductionConfig()
+	cfg.OutputPaths = nil
+	logger, err := v.WithCreateLogger(cfg)
+	assert.NoError(t, err)
+	logger.Info("test message", zap.String("trace_id", "abc"), zap.String("span_id", "def"))
+	assert.NoError(t, v.Flush(context.Background()))
+
+	value := (<-received).Streams[0].Values[0]
+	var metadata map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(value[2]), &metadata))
+	assert.Equal(t, "abc", metadata["trace_id"])
+	assert.Equal(t, "def", metadata["span_id"])
+	assert.Contains(t, metadata["caller"], "labels_test.go")
+	assert.NotContains(t, value[1], "caller")
+}
+
+func TestStaticFields(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		StaticFields: map[string]any{"version": "1.2.3", "region": "eu"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "test message", map[string]any{"region": "us"}))
+	assert.NoError(t, c.Flush(ctx))
+
+	var line map[string]any
+	assert.NoError(t, json.Unmarshal([]byte((<-received).Streams[0].Values[0][1]), &line))
+	assert.Equal(t, "1.2.3", line["version"])
+	assert.Equal(t, "us", line["region"], "Expected fields of the line to take precedence")
+}
+
+func TestLabelTemplates(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels: map[string]string{
+			"app":       "test",
+			"severity":  "{{.Level}}",
+			"subsystem": `{{.Field "subsystem"}}`,
+		},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "first", map[string]any{"subsystem": "db"}))
+	assert.NoError(t, c.PushEntry(ctx, "error", "second", nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	req := <-received
+	assert.Len(t, req.Streams, 2)
+	assert.Equal(t, map[string]string{"app": "test", "severity": "info", "subsystem": "db"}, req.Streams[0].Stream)
+	assert.Equal(t, map[string]string{"app": "test", "severity": "error"}, req.Streams[1].Stream, "Expected empty labels to be left out")
+}
@@ -0,0 +1,82 @@
+package zaploki
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// LineFormat is the format of the log lines sent to loki
+type LineFormat int
+
+const (
+	// FormatJSON sends the lines as they are encoded, JSON for zap
+	FormatJSON LineFormat = iota
+	// FormatLogfmt renders JSON lines as logfmt, e.g.
+	// level=info ts=1700000000.5 msg="request done" status=200
+	FormatLogfmt
+)
+
+// formatLine returns the log line of entry in Format
+func (c *Client) formatLine(entry *logEntry) string {
+	if c.config.Format != FormatLogfmt || entry.fields == nil {
+		// lines that are not JSON objects are sent as they are
+		return entry.line()
+	}
+	return fieldsToLogfmt(entry.fields)
+}
+
+// fieldsToLogfmt renders the fields of a JSON log line as logfmt in their
+// order. Nested objects and arrays become quoted JSON.
+func fieldsToLogfmt(fields []field) string {
+	var sb strings.Builder
+	for i, f := range fields {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(logfmtKey(f.key))
+		sb.WriteByte('=')
+		sb.WriteString(logfmtValue(f.value))
+	}
+	return sb.String()
+}
+
+// logfmtKey replaces the characters that can't be part of a logfmt key
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue renders an encoded JSON value for logfmt
+func logfmtValue(value json.RawMessage) string {
+	var s string
+	switch value[0] {
+	case '"':
+		if err := json.Unmarshal(value, &s); err != nil {
+			return string(value)
+		}
+	case '{', '[':
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, value); err != nil {
+			return string(value)
+		}
+		s = buf.String()
+	default:
+		// numbers, booleans and null
+		return string(value)
+	}
+	if s == "" || strings.IndexFunc(s, needsQuote) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func needsQuote(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == '\\' || !unicode.IsPrint(r)
+}
@@ -0,0 +1,52 @@
+package zaploki
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONToLogfmt(t *testing.T) {
+	c := &Client{config: &Config{Format: FormatLogfmt}}
+	for _, tc := range []struct {
+		json   string
+		logfmt string
+	}{
+		{json: `{"level":"info","ts":1700000000.5,"msg":"request done","status":200}`, logfmt: `level=info ts=1700000000.5 msg="request done" status=200`},
+		{json: `{"ok":true,"err":null,"empty":"","quote":"say \"hi\""}`, logfmt: `ok=true err=null empty="" quote="say \"hi\""`},
+		{json: `{"user":{"id":1,"name":"a b"},"tags":["x", "y"]}`, logfmt: `user="{\"id\":1,\"name\":\"a b\"}" tags="[\"x\",\"y\"]"`},
+		{json: `{"my key":"v=1"}`, logfmt: `my_key="v=1"`},
+		{json: `not json`, logfmt: `not json`},
+	} {
+		entry := parseLine([]byte(tc.json))
+		assert.Equal(t, tc.logfmt, c.formatLine(&entry))
+	}
+}
+
+func TestFormatLogfmt(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Format:       FormatLogfmt,
+		Labels:       map[string]string{"app": "test", "status": `{{.Field "status"}}`},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "request done", map[string]any{"status": 200}))
+	assert.NoError(t, c.Flush(ctx))
+
+	req := <-received
+	assert.Equal(t, map[string]string{"app": "test", "status": "200"}, req.Streams[0].Stream, "Expected templates to read the JSON fields")
+	assert.Regexp(t, `^level=info ts=[0-9.]+ msg="request done" status=200$`, req.Streams[0].Values[0][1])
+	assert.Zero(t, c.buffered.Load(), "Expected the buffered bytes to be released")
+}
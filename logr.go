@@ -0,0 +1,15 @@
+package zaploki
+
+import (
+	"log/slog"
+
+	"github.com/go-logr/logr"
+)
+
+// LogSink returns a logr.LogSink that sends log lines to loki, for use with
+// controller-runtime and other logr based code. Lines up to the given
+// verbosity are sent, e.g. 1 to include logger.V(1). They are encoded like the
+// ones from SlogHandler, with the level debug for verbosity levels above 0.
+func (c *Client) LogSink(verbosity int) logr.LogSink {
+	return logr.FromSlogHandler(c.slogHandler(slog.Level(-verbosity))).GetSink()
+}
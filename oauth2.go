@@ -0,0 +1,125 @@
+package zaploki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth2 configures the client credentials flow of OAuth 2.0. The client
+// fetches an access token from TokenURL and refreshes it before it expires.
+// Tokens are fetched with http.DefaultClient, without the Transport and TLS
+// config of the requests to loki.
+type OAuth2 struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// EndpointParams are further form values of the token request, e.g. an
+	// audience
+	EndpointParams url.Values
+}
+
+// tokenExpiryMargin is how long before its expiry a token is refreshed
+const tokenExpiryMargin = 30 * time.Second
+
+// oauthTokens fetches and caches the access tokens of an OAuth2 config
+type oauthTokens struct {
+	cfg    *OAuth2
+	client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// newOAuthTokens returns nil if cfg is nil, which disables OAuth2
+func newOAuthTokens(cfg *OAuth2, client *http.Client) *oauthTokens {
+	if cfg == nil {
+		return nil
+	}
+	return &oauthTokens{cfg: cfg, client: client}
+}
+
+// get returns a valid access token, fetching a new one if needed
+func (o *oauthTokens) get(ctx context.Context) (string, error) {
+	if o == nil {
+		return "", nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.token != "" && (o.expiry.IsZero() || time.Now().Before(o.expiry)) {
+		return o.token, nil
+	}
+	token, expiry, err := o.fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get oauth2 token: %w", err)
+	}
+	o.token, o.expiry = token, expiry
+	return token, nil
+}
+
+// invalidate discards the cached token, e.g. after loki rejected it
+func (o *oauthTokens) invalidate() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.token = ""
+}
+
+// fetch requests a new access token from the token endpoint
+func (o *oauthTokens) fetch(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.cfg.Scopes, " "))
+	}
+	for k, v := range o.cfg.EndpointParams {
+		form[k] = v
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", time.Time{}, err
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token endpoint returned no access token")
+	}
+	var expiry time.Time
+	if token.ExpiresIn > 0 {
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+		// short lived tokens are used for half their lifetime
+		expiry = time.Now().Add(lifetime - min(tokenExpiryMargin, lifetime/2))
+	}
+	return token.AccessToken, expiry, nil
+}
@@ -0,0 +1,139 @@
+package zaploki
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrDropped is reported to callers that wait for a log line to be sent when
+// the line was dropped because the queue or MaxBufferedBytes was full
+var ErrDropped = errors.New("log line dropped because the queue is full")
+
+// OverflowPolicy decides what happens to a log line when the queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the caller wait until there is room in the queue
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the log line that is being added
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued log line to make room. It
+	// blocks like OverflowBlock if QueueSize is 0, as there are no queued
+	// lines to drop. When MaxBufferedBytes is reached, the oldest held batches
+	// and queued lines are dropped instead of new lines and the current batch
+	// is sent, so the most recent lines reach loki once it is available again.
+	OverflowDropOldest
+)
+
+// offer adds entry to the queue according to the overflow policy
+func (c *Client) offer(ctx context.Context, entry logEntry) error {
+	policy := c.config.OverflowPolicy
+	if policy == OverflowDropOldest && cap(c.entry) == 0 {
+		policy = OverflowBlock
+	}
+
+	switch policy {
+	case OverflowDropNewest:
+		select {
+		case c.entry <- entry:
+		case <-c.quit:
+			return ErrStopped
+		default:
+			c.drop(entry)
+		}
+		return nil
+	case OverflowDropOldest:
+		for {
+			select {
+			case c.entry <- entry:
+				return nil
+			case <-c.quit:
+				return ErrStopped
+			default:
+			}
+			select {
+			case oldest := <-c.entry:
+				c.drop(oldest)
+			default:
+			}
+		}
+	}
+
+	select {
+	case c.entry <- entry:
+		return nil
+	case <-c.quit:
+		return ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drop counts entry as dropped and releases a caller waiting for it
+func (c *Client) drop(entry logEntry) {
+	c.countDropped(1)
+	c.buffered.Add(int64(-len(entry.raw)))
+	if entry.sent != nil {
+		entry.sent <- ErrDropped
+	}
+}
+
+// countDropped counts n dropped log lines and reports them to OnDrop
+func (c *Client) countDropped(n int) {
+	c.dropped.Add(uint64(n))
+	if c.config.OnDrop != nil {
+		c.config.OnDrop(n)
+	}
+}
+
+// Dropped returns the number of log lines that were dropped because the
+// queue or MaxBufferedBytes was full
+func (c *Client) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
+// dropsNewest reports whether log lines beyond MaxBufferedBytes are dropped
+// when they are added, rather than by dropping the oldest held batches
+func (c *Client) dropsNewest() bool {
+	return c.config.MaxBufferedBytes > 0 && c.config.OverflowPolicy != OverflowDropOldest
+}
+
+// dropsOldest reports whether the oldest log lines are dropped when
+// MaxBufferedBytes is exceeded
+func (c *Client) dropsOldest() bool {
+	return c.config.MaxBufferedBytes > 0 && c.config.OverflowPolicy == OverflowDropOldest
+}
+
+// dropOldest drops the oldest held batches and then the oldest queued log
+// lines while MaxBufferedBytes is exceeded. The current batch is sent or held
+// by the run loop once it sees the limit exceeded, see full.
+func (c *Client) dropOldest() {
+	c.heldMu.Lock()
+	c.trimHeld()
+	c.heldMu.Unlock()
+	for c.buffered.Load() > int64(c.config.MaxBufferedBytes) {
+		select {
+		case oldest := <-c.entry:
+			c.drop(oldest)
+		default:
+			return
+		}
+	}
+}
+
+// trimHeld drops the oldest held batches while MaxBufferedBytes is exceeded.
+// c.heldMu must be held.
+func (c *Client) trimHeld() {
+	if c.config.MaxBufferedBytes <= 0 {
+		return
+	}
+	for len(c.held) > 0 && c.buffered.Load() > int64(c.config.MaxBufferedBytes) {
+		oldest := c.held[0]
+		c.held = c.held[1:]
+		c.countDropped(oldest.lines)
+		c.buffered.Add(int64(-oldest.buffered))
+		for _, sent := range oldest.waiters {
+			sent <- ErrDropped
+		}
+	}
+}
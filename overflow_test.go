@@ -0,0 +1,148 @@
+package zaploki
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestOverflowPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   OverflowPolicy
+		expected []string
+	}{
+		{name: "drop newest", policy: OverflowDropNewest, expected: []string{"blocking", "0", "1"}},
+		{name: "drop oldest", policy: OverflowDropOldest, expected: []string{"blocking", "2", "3"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			release := make(chan struct{})
+			received := make(chan string, 10)
+			mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+				for _, s := range req.Streams {
+					for _, v := range s.Values {
+						received <- parseLine([]byte(v[1])).Message
+					}
+				}
+				<-release
+			})
+			defer mockServer.Close()
+
+			c := NewClient(context.Background(), Config{
+				Url:            mockServer.URL,
+				BatchMaxSize:   100,
+				BatchMaxWait:   10 * time.Second,
+				QueueSize:      2,
+				OverflowPolicy: tc.policy,
+				FlushOnLevel:   zapcore.ErrorLevel,
+			})
+
+			// the first line occupies the run loop until release is closed
+			go c.PushEntry(context.Background(), "error", "blocking", nil)
+			assert.Equal(t, "blocking", <-received)
+			for _, msg := range []string{"0", "1", "2", "3"} {
+				assert.NoError(t, c.PushEntry(context.Background(), "info", msg, nil))
+			}
+			assert.Equal(t, uint64(2), c.Dropped(), "Expected the overflowing lines to be dropped")
+
+			close(release)
+			assert.NoError(t, c.Close(context.Background()))
+			close(received)
+
+			var messages []string
+			for msg := range received {
+				messages = append(messages, msg)
+			}
+			assert.Equal(t, tc.expected, append([]string{"blocking"}, messages...))
+		})
+	}
+}
+
+func TestMaxBufferedBytes(t *testing.T) {
+	c := NewClient(context.Background(), Config{
+		Url:              "http://localhost",
+		BatchMaxSize:     100,
+		BatchMaxWait:     10 * time.Second,
+		MaxBufferedBytes: 200,
+	})
+	c.Pause()
+	defer c.Close(context.Background())
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, c.Push(context.Background(), "info", "a line of roughly one hundred bytes", nil))
+	}
+	assert.Equal(t, uint64(3), c.Dropped(), "Expected lines above the limit to be dropped")
+	assert.LessOrEqual(t, c.buffered.Load(), int64(200))
+}
+
+func TestDropOldestKeepsNewestHeldBatches(t *testing.T) {
+	received := make(chan lokiPushRequest, 10)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:              mockServer.URL,
+		BatchMaxSize:     2,
+		BatchMaxWait:     10 * time.Second,
+		MaxBufferedBytes: 400,
+		OverflowPolicy:   OverflowDropOldest,
+	})
+	c.Pause()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, c.PushEntry(context.Background(), "info", "a line of roughly one hundred bytes", map[string]any{"i": i}))
+	}
+	assert.NoError(t, c.Close(context.Background()))
+
+	var kept []float64
+	close(received)
+	for req := range received {
+		for _, v := range req.Streams[0].Values {
+			var line map[string]any
+			assert.NoError(t, json.Unmarshal([]byte(v[1]), &line))
+			kept = append(kept, line["i"].(float64))
+		}
+	}
+	assert.Greater(t, c.Dropped(), uint64(0), "Expected the oldest held batches to be dropped")
+	assert.Equal(t, 10, int(c.Dropped())+len(kept), "Expected every line to be sent or dropped")
+	for i, v := range kept {
+		assert.Equal(t, float64(10-len(kept)+i), v, "Expected the newest lines to be sent")
+	}
+}
+
+func TestDropOldestLimitsQueuedBytes(t *testing.T) {
+	release := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:              mockServer.URL,
+		BatchMaxSize:     2,
+		BatchMaxWait:     10 * time.Second,
+		QueueSize:        100,
+		MaxBufferedBytes: 400,
+		OverflowPolicy:   OverflowDropOldest,
+	})
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, c.PushEntry(context.Background(), "info", "a line of roughly one hundred bytes", map[string]any{"i": i}))
+		assert.LessOrEqual(t, c.buffered.Load(), int64(400), "Expected queued lines to be dropped above the limit")
+	}
+	close(release)
+	assert.NoError(t, c.Close(context.Background()))
+
+	stats := c.Stats()
+	assert.Greater(t, stats.Dropped, uint64(0), "Expected the oldest queued lines to be dropped")
+	assert.Equal(t, uint64(20), stats.Sent+stats.Dropped, "Expected every line to be sent or dropped")
+}
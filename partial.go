@@ -0,0 +1,117 @@
+package zaploki
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loki reports every rejected line of a push request on its own line of the
+// response body
+var (
+	tooOldOrNewPattern = regexp.MustCompile(`entry for stream '(\{.*?\})' has timestamp too (?:old|new): ([0-9T:.+\-Z]+)`)
+	outOfOrderPattern  = regexp.MustCompile(`entry with timestamp (.+?) ignored, reason: '.*?' for stream: (\{.*?\})`)
+	lineTooLongPattern = regexp.MustCompile(`Max entry size '(\d+)' bytes exceeded for stream '(\{.*?\})' while adding an entry with length '(\d+)' bytes`)
+)
+
+// rejection is a line of a push request that loki rejected. Lines that are too
+// long are truncated to maxSize, other lines are dropped.
+type rejection struct {
+	stream  string
+	ts      time.Time
+	maxSize int
+}
+
+// parseRejections returns the rejected lines listed in the body of a 400
+// response
+func parseRejections(body string) []rejection {
+	var rejections []rejection
+	for _, m := range tooOldOrNewPattern.FindAllStringSubmatch(body, -1) {
+		if ts, err := time.Parse(time.RFC3339Nano, m[2]); err == nil {
+			rejections = append(rejections, rejection{stream: m[1], ts: ts})
+		}
+	}
+	for _, m := range outOfOrderPattern.FindAllStringSubmatch(body, -1) {
+		if ts, err := parseRejectedTime(m[1]); err == nil {
+			rejections = append(rejections, rejection{stream: m[2], ts: ts})
+		}
+	}
+	for _, m := range lineTooLongPattern.FindAllStringSubmatch(body, -1) {
+		if size, err := strconv.Atoi(m[1]); err == nil && size > 0 {
+			rejections = append(rejections, rejection{stream: m[2], maxSize: size})
+		}
+	}
+	return rejections
+}
+
+func parseRejectedTime(value string) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return ts, nil
+	}
+	return time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", value)
+}
+
+// matches reports whether v is the line that r refers to. Loki may report
+// timestamps with second precision only.
+func (r rejection) matches(v streamValue) bool {
+	if r.maxSize > 0 {
+		return len(v[1]) > r.maxSize
+	}
+	ts := time.Unix(0, v.timestamp())
+	if r.ts.Nanosecond() == 0 {
+		ts = ts.Truncate(time.Second)
+	}
+	return ts.Equal(r.ts)
+}
+
+// without returns req with the rejected lines dropped or truncated and the
+// number of lines that were changed
+func (req lokiPushRequest) without(rejections []rejection) (lokiPushRequest, int) {
+	byStream := make(map[string][]rejection)
+	for _, r := range rejections {
+		byStream[r.stream] = append(byStream[r.stream], r)
+	}
+
+	var fixed lokiPushRequest
+	changed := 0
+	for _, s := range req.Streams {
+		rs := byStream[lokiLabels(s.Stream)]
+		values := make([]streamValue, 0, len(s.Values))
+	values:
+		for _, v := range s.Values {
+			for _, r := range rs {
+				if !r.matches(v) {
+					continue
+				}
+				changed++
+				if r.maxSize == 0 {
+					continue values
+				}
+				v = v.withLine(v[1][:r.maxSize])
+				break
+			}
+			values = append(values, v)
+		}
+		if len(values) > 0 {
+			fixed.Streams = append(fixed.Streams, s.withValues(values))
+		}
+	}
+	return fixed, changed
+}
+
+// lokiLabels renders labels the way loki does in error messages
+func lokiLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+strconv.Quote(labels[k]))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
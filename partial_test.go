@@ -0,0 +1,69 @@
+package zaploki
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartialFailure(t *testing.T) {
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	received := make(chan lokiPushRequest, 2)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := decodePushRequest(t, r)
+		received <- req
+		if len(req.Streams[0].Values) == 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "entry for stream '{app=\"test\"}' has timestamp too old: %s, oldest acceptable timestamp is: 2024-01-01T00:00:00Z\n", old.Format(time.RFC3339))
+			fmt.Fprintln(w, "Max entry size '10' bytes exceeded for stream '{app=\"test\"}' while adding an entry with length '20' bytes")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{Url: mockServer.URL, BatchMaxSize: 100})
+	defer c.Stop()
+
+	now := time.Now()
+	err := c.send(context.Background(), lokiPushRequest{Streams: []stream{{
+		Stream: map[string]string{"app": "test"},
+		Values: []streamValue{
+			{fmt.Sprint(old.UnixNano()), "too old"},
+			{fmt.Sprint(now.UnixNano()), "valid"},
+			{fmt.Sprint(now.UnixNano() + 1), "this line is too long"},
+		},
+	}}})
+	assert.NoError(t, err)
+
+	<-received
+	retried := <-received
+	assert.Equal(t, []streamValue{
+		{fmt.Sprint(now.UnixNano()), "valid"},
+		{fmt.Sprint(now.UnixNano() + 1), "this line "},
+	}, retried.Streams[0].Values, "Expected the rejected lines to be dropped or truncated")
+}
+
+func TestPartialFailureWithoutReasons(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "invalid labels")
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{Url: mockServer.URL, BatchMaxSize: 100})
+	defer c.Stop()
+
+	err := c.send(context.Background(), lokiPushRequest{Streams: []stream{{
+		Stream: map[string]string{"app": "test"},
+		Values: []streamValue{{fmt.Sprint(time.Now().UnixNano()), "line"}},
+	}}})
+	var respErr *ResponseError
+	assert.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusBadRequest, respErr.StatusCode)
+}
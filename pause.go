@@ -0,0 +1,58 @@
+package zaploki
+
+// Pause stops sending requests to loki, e.g. during a maintenance window of
+// loki. Log lines are still batched and full batches are held in memory until
+// Resume is called. Flush and Sync hold the current batch as well, only Close
+// sends the held batches regardless. While paused, callers that normally wait
+// for their line to be sent return as soon as it is held.
+func (c *Client) Pause() {
+	c.paused.Store(true)
+}
+
+// Resume sends the batches that were held while paused and continues sending
+// new batches
+func (c *Client) Resume() {
+	c.paused.Store(false)
+	c.wakeHeld()
+}
+
+// hold keeps p until Resume is called, releasing its waiting producers
+func (c *Client) hold(p pendingRequest) {
+	for _, sent := range p.waiters {
+		sent <- nil
+	}
+	p.waiters = nil
+
+	c.heldMu.Lock()
+	defer c.heldMu.Unlock()
+	c.held = append(c.held, p)
+	c.trimHeld()
+}
+
+// wakeHeld makes the run loop send the held batches
+func (c *Client) wakeHeld() {
+	select {
+	case c.heldReady <- struct{}{}:
+	default:
+		// the run loop is already woken up
+	}
+}
+
+// takeHeld removes and returns the held batches, oldest first
+func (c *Client) takeHeld() []pendingRequest {
+	c.heldMu.Lock()
+	defer c.heldMu.Unlock()
+	held := c.held
+	c.held = nil
+	return held
+}
+
+// dispatchHeld sends the batches that were held while paused or rate limited
+func (c *Client) dispatchHeld() {
+	if c.paused.Load() {
+		return
+	}
+	for _, p := range c.takeHeld() {
+		c.dispatch(p)
+	}
+}
@@ -0,0 +1,68 @@
+package zaploki
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseResume(t *testing.T) {
+	received := make(chan lokiPushRequest, 10)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 2,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer c.Stop()
+
+	c.Pause()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+	}
+
+	select {
+	case <-received:
+		t.Fatal("Expected no requests while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Resume()
+	for i := 0; i < 2; i++ {
+		select {
+		case req := <-received:
+			assert.Len(t, req.Streams[0].Values, 2, "Expected the held batches to be sent")
+		case <-time.After(time.Second):
+			t.Fatal("Expected the held batches to be sent on resume")
+		}
+	}
+}
+
+func TestFlushWhilePaused(t *testing.T) {
+	received := make(chan lokiPushRequest, 10)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer c.Stop()
+
+	c.Pause()
+	assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+	assert.NoError(t, c.Flush(context.Background()), "Expected Flush to hold the batch while paused")
+	assert.Empty(t, received, "Expected no requests while paused")
+
+	assert.NoError(t, c.Close(context.Background()))
+	assert.Len(t, received, 1, "Expected Close to send the held batch")
+}
@@ -0,0 +1,95 @@
+package zaploki
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	"github.com/golang/snappy"
+)
+
+// PushFormat is the format push requests are sent in
+type PushFormat int
+
+const (
+	// PushJSON sends JSON push requests
+	PushJSON PushFormat = iota
+	// PushProtobuf sends snappy compressed protobuf push requests, the
+	// format of promtail, which is cheaper for loki to ingest
+	PushProtobuf
+)
+
+// encodeProtobuf returns the snappy compressed logproto.PushRequest of req
+func encodeProtobuf(req lokiPushRequest) []byte {
+	return snappy.Encode(nil, marshalPushRequest(req))
+}
+
+// marshalPushRequest encodes req as a logproto.PushRequest:
+//
+//	PushRequest   { repeated Stream streams = 1; }
+//	Stream        { string labels = 1; repeated Entry entries = 2; }
+//	Entry         { Timestamp timestamp = 1; string line = 2; repeated LabelPair structuredMetadata = 3; }
+//	Timestamp     { int64 seconds = 1; int32 nanos = 2; }
+//	LabelPair     { string name = 1; string value = 2; }
+func marshalPushRequest(req lokiPushRequest) []byte {
+	var b, s, e, m []byte
+	for _, st := range req.Streams {
+		s = appendString(s[:0], 1, lokiLabels(st.Stream))
+		for _, v := range st.Values {
+			ts := v.timestamp()
+			var t []byte
+			t = appendVarint(t, 1, uint64(ts/1e9))
+			t = appendVarint(t, 2, uint64(ts%1e9))
+
+			e = appendBytes(e[:0], 1, t)
+			e = appendString(e, 2, v[1])
+			for _, pair := range metadataPairs(v) {
+				m = appendString(m[:0], 1, pair[0])
+				m = appendString(m, 2, pair[1])
+				e = appendBytes(e, 3, m)
+			}
+			s = appendBytes(s, 2, e)
+		}
+		b = appendBytes(b, 1, s)
+	}
+	return b
+}
+
+// metadataPairs returns the structured metadata of v sorted by name
+func metadataPairs(v streamValue) [][2]string {
+	if len(v) < 3 {
+		return nil
+	}
+	var metadata map[string]string
+	if err := json.Unmarshal([]byte(v[2]), &metadata); err != nil {
+		return nil
+	}
+	pairs := make([][2]string, 0, len(metadata))
+	for k, value := range metadata {
+		pairs = append(pairs, [2]string{k, value})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+	return pairs
+}
+
+// appendVarint appends a varint field, leaving out zero values like protobuf
+func appendVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytes appends a length delimited field
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
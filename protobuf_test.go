@@ -0,0 +1,105 @@
+package zaploki
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+)
+
+// protoFields decodes the fields of a protobuf message. Varints are returned
+// as their value encoded with binary.AppendUvarint.
+func protoFields(t *testing.T, b []byte) map[int][][]byte {
+	fields := make(map[int][][]byte)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			b = b[n:]
+			fields[field] = append(fields[field], binary.AppendUvarint(nil, v))
+		case 2:
+			size, n := binary.Uvarint(b)
+			b = b[n:]
+			fields[field] = append(fields[field], b[:size])
+			b = b[size:]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+	}
+	return fields
+}
+
+func protoVarint(b []byte) uint64 {
+	v, _ := binary.Uvarint(b)
+	return v
+}
+
+func TestMarshalPushRequest(t *testing.T) {
+	req := lokiPushRequest{Streams: []stream{{
+		Stream: map[string]string{"app": "test", "env": "prod"},
+		Values: []streamValue{
+			{"1700000000123456789", "first", `{"trace_id":"abc"}`},
+			{"1700000001000000000", "second"},
+		},
+	}}}
+
+	streams := protoFields(t, marshalPushRequest(req))[1]
+	assert.Len(t, streams, 1)
+	stream := protoFields(t, streams[0])
+	assert.Equal(t, `{app="test", env="prod"}`, string(stream[1][0]))
+	assert.Len(t, stream[2], 2)
+
+	entry := protoFields(t, stream[2][0])
+	ts := protoFields(t, entry[1][0])
+	assert.Equal(t, uint64(1700000000), protoVarint(ts[1][0]))
+	assert.Equal(t, uint64(123456789), protoVarint(ts[2][0]))
+	assert.Equal(t, "first", string(entry[2][0]))
+	metadata := protoFields(t, entry[3][0])
+	assert.Equal(t, "trace_id", string(metadata[1][0]))
+	assert.Equal(t, "abc", string(metadata[2][0]))
+
+	entry = protoFields(t, stream[2][1])
+	assert.Empty(t, protoFields(t, entry[1][0])[2], "Expected zero nanos to be left out")
+	assert.Equal(t, "second", string(entry[2][0]))
+	assert.Empty(t, entry[3])
+}
+
+func TestPushProtobuf(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Empty(t, r.Header.Get("Content-Encoding"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		PushFormat:   PushProtobuf,
+		Labels:       map[string]string{"app": "test"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	decoded, err := snappy.Decode(nil, <-bodies)
+	assert.NoError(t, err)
+	stream := protoFields(t, protoFields(t, decoded)[1][0])
+	assert.Equal(t, `{app="test"}`, string(stream[1][0]))
+	line := string(protoFields(t, stream[2][0])[2][0])
+	assert.Equal(t, "test message", parseLine([]byte(line)).Message)
+}
@@ -0,0 +1,59 @@
+package zaploki
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// LabelProvider detects labels of the environment, such as the datacenter or
+// the deployment, that are added to all log lines
+type LabelProvider interface {
+	Labels(ctx context.Context) (map[string]string, error)
+}
+
+// LabelProviderFunc adapts a function to a LabelProvider
+type LabelProviderFunc func(ctx context.Context) (map[string]string, error)
+
+func (f LabelProviderFunc) Labels(ctx context.Context) (map[string]string, error) {
+	return f(ctx)
+}
+
+// provideLabels asks every LabelProvider for its labels. Providers that fail
+// keep the labels they returned before.
+func (c *Client) provideLabels() map[string]string {
+	if c.provided == nil {
+		c.provided = make([]map[string]string, len(c.config.LabelProviders))
+	}
+	var labels map[string]string
+	for i, p := range c.config.LabelProviders {
+		provided, err := p.Labels(c.ctx)
+		if err != nil {
+			c.logger.Warn("failed to detect labels", slog.Any("error", err))
+		} else {
+			c.provided[i] = provided
+		}
+		labels = mergeLabels(labels, c.provided[i])
+	}
+	return labels
+}
+
+// refreshLabels updates the labels of the LabelProviders every
+// LabelRefreshInterval until the client is stopped
+func (c *Client) refreshLabels() {
+	ticker := time.NewTicker(c.config.LabelRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.quit:
+			return
+		}
+
+		labels := c.provideLabels()
+		c.update(func() {
+			c.detected = mergeLabels(c.environment, labels)
+			c.applyLabels()
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package zaploki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBodySize limits how much of an error response is kept
+const maxErrorBodySize = 8 << 10
+
+// ResponseError is returned when loki answers a push request with a status
+// code other than 2xx, or other than 204 with StrictStatus
+type ResponseError struct {
+	StatusCode int
+	Status     string
+	// RetryAfter is the wait that loki asked for with a Retry-After header
+	RetryAfter time.Duration
+	// Body is the start of the response body, which usually explains why the
+	// request was rejected
+	Body string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("recieved unexpected response code from Loki: %s: %s", e.Status, e.Body)
+	}
+	return fmt.Sprintf("recieved unexpected response code from Loki: %s", e.Status)
+}
+
+// send pushes req to loki. The lines of every stream are sorted by timestamp
+// first, since loki may reject out of order lines.
+func (c *Client) send(ctx context.Context, req lokiPushRequest) error {
+	if c.config.MaxEntryAge > 0 {
+		req.clamp(time.Now().Add(-c.config.MaxEntryAge))
+	}
+	req.sort()
+	var errs []error
+	for _, r := range req.byTenant() {
+		errs = append(errs, c.sendRequest(ctx, r))
+	}
+	err := errors.Join(errs...)
+	c.health.record(err)
+	return err
+}
+
+// sendRequest pushes req to loki. Requests that are rejected as too large
+// are split in half and the halves are sent on their own.
+func (c *Client) sendRequest(ctx context.Context, req lokiPushRequest) error {
+	err := c.postWithRetry(ctx, req)
+
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	switch respErr.StatusCode {
+	case http.StatusRequestEntityTooLarge:
+		if first, second, ok := req.split(); ok {
+			return errors.Join(c.sendRequest(ctx, first), c.sendRequest(ctx, second))
+		}
+	case http.StatusBadRequest:
+		// loki lists the lines it rejected, the others may be sent again
+		fixed, changed := req.without(parseRejections(respErr.Body))
+		if changed == 0 {
+			return err
+		}
+		c.logger.Warn("loki rejected some log lines, sending the others again", slog.Int("rejected", changed), slog.String("reason", respErr.Body))
+		if len(fixed.Streams) == 0 {
+			return nil
+		}
+		return c.postWithRetry(ctx, fixed)
+	}
+	return err
+}
+
+func (c *Client) post(ctx context.Context, pushReq lokiPushRequest) error {
+	if err := c.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	if c.grpc != nil {
+		return c.pushGRPC(ctx, pushReq)
+	}
+
+	body, err := c.encodeRequest(pushReq)
+	if err != nil {
+		return err
+	}
+	c.recycleConnections()
+
+	tenant := pushReq.tenant()
+	order := c.endpointOrder()
+	if c.config.HedgeDelay > 0 && len(order) > 1 {
+		return c.postHedged(ctx, order, tenant, body)
+	}
+
+	// move on to the next endpoint while loki seems to be unavailable
+	for _, e := range order {
+		e.pending.Add(1)
+		err = c.postTo(ctx, e.url, tenant, body)
+		e.pending.Add(-1)
+		e.record(err, c.failoverCooldown())
+		if !countsAsFailure(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// pushBody is an encoded push request with its content headers
+type pushBody struct {
+	data            []byte
+	contentType     string
+	contentEncoding string
+}
+
+// encodeRequest returns the body of a push request in PushFormat
+func (c *Client) encodeRequest(pushReq lokiPushRequest) (pushBody, error) {
+	if c.config.PushFormat == PushProtobuf {
+		return pushBody{data: encodeProtobuf(pushReq), contentType: "application/x-protobuf"}, nil
+	}
+
+	data, err := json.Marshal(pushReq)
+	if err != nil {
+		return pushBody{}, err
+	}
+	data, encoding, err := c.compress(data)
+	if err != nil {
+		return pushBody{}, err
+	}
+	return pushBody{data: data, contentType: "application/json", contentEncoding: encoding}, nil
+}
+
+// postTo sends the encoded body of a push request for tenant to url
+func (c *Client) postTo(ctx context.Context, url, tenant string, body pushBody) error {
+	if c.config.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.RequestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body.data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := c.setHeaders(req, tenant); err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", body.contentType)
+	if body.contentEncoding != "" {
+		req.Header.Set("Content-Encoding", body.contentEncoding)
+	} else {
+		req.Header.Del("Content-Encoding")
+	}
+	if err := c.sigv4.sign(req, body.data); err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if !c.accepted(resp.StatusCode) {
+		respErr := &ResponseError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			// the token may have been revoked, get a new one next time
+			c.oauth.invalidate()
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		respErr.Body = strings.TrimSpace(string(body))
+		c.logger.Debug("loki rejected push request", slog.String("url", req.URL.Redacted()), slog.String("status", resp.Status), slog.String("body", respErr.Body))
+		return respErr
+	}
+
+	return nil
+}
+
+// setHeaders sets the User-Agent, Headers, tenant and credentials of a
+// request for tenant
+func (c *Client) setHeaders(req *http.Request, tenant string) error {
+	req.Header.Set("User-Agent", c.userAgent())
+	for k, v := range c.config.Headers {
+		req.Header.Set(k, v)
+	}
+	c.setTenant(req, tenant)
+	return c.authorize(req)
+}
+
+// accepted reports whether a push request answered with status succeeded
+func (c *Client) accepted(status int) bool {
+	if c.config.StrictStatus {
+		return status == http.StatusNoContent
+	}
+	return status >= 200 && status < 300
+}
+
+// split divides the values of r into two requests of about the same number
+// of lines. It returns false if r has less than two lines.
+func (r lokiPushRequest) split() (lokiPushRequest, lokiPushRequest, bool) {
+	total := 0
+	for _, s := range r.Streams {
+		total += len(s.Values)
+	}
+	if total < 2 {
+		return r, lokiPushRequest{}, false
+	}
+
+	var first, second lokiPushRequest
+	remaining := total / 2
+	for _, s := range r.Streams {
+		n := min(remaining, len(s.Values))
+		if n > 0 {
+			first.Streams = append(first.Streams, s.withValues(s.Values[:n]))
+		}
+		if n < len(s.Values) {
+			second.Streams = append(second.Streams, s.withValues(s.Values[n:]))
+		}
+		remaining -= n
+	}
+	return first, second, true
+}
+
+// sort orders the values of every stream by timestamp, keeping the order of
+// values with the same timestamp
+func (r lokiPushRequest) sort() {
+	for _, s := range r.Streams {
+		sort.SliceStable(s.Values, func(i, j int) bool {
+			return s.Values[i].timestamp() < s.Values[j].timestamp()
+		})
+	}
+}
+
+// clamp moves the timestamps of values older than oldest to oldest
+func (r lokiPushRequest) clamp(oldest time.Time) {
+	limit := oldest.UnixNano()
+	for _, s := range r.Streams {
+		for _, v := range s.Values {
+			if v.timestamp() < limit {
+				v[0] = strconv.FormatInt(limit, 10)
+			}
+		}
+	}
+}
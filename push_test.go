@@ -0,0 +1,145 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendSplitsTooLargeRequests(t *testing.T) {
+	var lines int
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := decodePushRequest(t, r)
+		if len(req.Streams) != 1 || len(req.Streams[0].Values) > 1 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		lines++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer c.Stop()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+	}
+	assert.NoError(t, c.Flush(context.Background()), "Expected the split requests to succeed")
+	assert.Equal(t, 3, lines, "Expected every line to be sent")
+}
+
+func TestPushRequestSortAndClamp(t *testing.T) {
+	req := lokiPushRequest{Streams: []stream{{
+		Values: []streamValue{{"300", "c"}, {"100", "a"}, {"200", "b"}, {"100", "a2"}},
+	}}}
+
+	req.clamp(time.Unix(0, 150))
+	req.sort()
+
+	assert.Equal(t, []streamValue{{"150", "a"}, {"150", "a2"}, {"200", "b"}, {"300", "c"}}, req.Streams[0].Values)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:            mockServer.URL,
+		BatchMaxSize:   100,
+		BatchMaxWait:   10 * time.Second,
+		RequestTimeout: 50 * time.Millisecond,
+	})
+	defer c.Stop()
+
+	assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+	assert.ErrorIs(t, c.Flush(context.Background()), context.DeadlineExceeded)
+}
+
+func TestResponseErrorBody(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "error at least one label pair is required per stream", http.StatusBadRequest)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{Url: mockServer.URL, BatchMaxSize: 100})
+	defer c.Stop()
+
+	assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+	err := c.Flush(context.Background())
+	var respErr *ResponseError
+	assert.ErrorAs(t, err, &respErr)
+	assert.Equal(t, "error at least one label pair is required per stream", respErr.Body)
+	assert.Contains(t, err.Error(), "at least one label pair")
+}
+
+func TestAcceptedStatus(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer mockServer.Close()
+
+	for _, strict := range []bool{false, true} {
+		c := NewClient(context.Background(), Config{Url: mockServer.URL, BatchMaxSize: 100, StrictStatus: strict})
+		assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+		err := c.Flush(context.Background())
+		if strict {
+			assert.Error(t, err, "Expected only 204 to be accepted in strict mode")
+		} else {
+			assert.NoError(t, err, "Expected any 2xx to be accepted")
+		}
+		c.Stop()
+	}
+}
+
+// requestHeaders pushes a line with cfg and returns the headers of the request
+func requestHeaders(t *testing.T, cfg Config) http.Header {
+	headers := make(chan http.Header, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	cfg.Url = mockServer.URL
+	cfg.BatchMaxSize = 100
+	c := NewClient(context.Background(), cfg)
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+	return <-headers
+}
+
+func TestHeaders(t *testing.T) {
+	headers := requestHeaders(t, Config{Headers: map[string]string{
+		"Cf-Access-Client-Id": "client",
+		"Content-Encoding":    "identity",
+	}})
+	assert.Equal(t, "client", headers.Get("Cf-Access-Client-Id"))
+	assert.Equal(t, "gzip", headers.Get("Content-Encoding"), "Expected the content headers to be kept")
+}
+
+func TestUserAgent(t *testing.T) {
+	headers := requestHeaders(t, Config{})
+	assert.Equal(t, DefaultUserAgent(), headers.Get("User-Agent"))
+	assert.Regexp(t, "^zap-loki/", headers.Get("User-Agent"))
+
+	headers = requestHeaders(t, Config{UserAgent: DefaultUserAgent() + " checkout/1.4"})
+	assert.Equal(t, DefaultUserAgent()+" checkout/1.4", headers.Get("User-Agent"))
+}
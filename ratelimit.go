@@ -0,0 +1,74 @@
+package zaploki
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// rateLimited reports whether err is loki rejecting a request because of rate
+// limiting. All following requests are delayed by the returned wait.
+func (c *Client) rateLimited(err error) (time.Duration, bool) {
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	delay := respErr.RetryAfter
+	if delay <= 0 {
+		delay = c.backoff(0)
+	}
+	c.delayRequests(delay)
+	return delay, true
+}
+
+// delayRequests makes requests wait for d before they are sent
+func (c *Client) delayRequests(d time.Duration) {
+	notBefore := time.Now().Add(d).UnixNano()
+	for {
+		current := c.notBefore.Load()
+		if current >= notBefore || c.notBefore.CompareAndSwap(current, notBefore) {
+			return
+		}
+	}
+}
+
+// waitRateLimit waits until loki accepts requests again
+func (c *Client) waitRateLimit(ctx context.Context) error {
+	d := time.Until(time.Unix(0, c.notBefore.Load()))
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requeue holds p in front of the other held batches and sends it after
+// delay
+func (c *Client) requeue(p pendingRequest, delay time.Duration) {
+	c.heldMu.Lock()
+	c.held = append([]pendingRequest{p}, c.held...)
+	c.trimHeld()
+	c.heldMu.Unlock()
+
+	time.AfterFunc(delay, c.wakeHeld)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as a date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
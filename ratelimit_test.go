@@ -0,0 +1,54 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitedBatchesAreRequeued(t *testing.T) {
+	var attempts atomic.Int32
+	received := make(chan lokiPushRequest, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := decodePushRequest(t, r)
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		received <- req
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    2,
+		BatchMaxWait:    10 * time.Second,
+		RetryMinBackoff: 10 * time.Millisecond,
+	})
+	defer c.Stop()
+
+	assert.NoError(t, c.Push(context.Background(), "info", "first", nil))
+	assert.NoError(t, c.Push(context.Background(), "info", "second", nil))
+
+	select {
+	case req := <-received:
+		assert.Len(t, req.Streams[0].Values, 2, "Expected the requeued batch to be sent")
+	case <-time.After(time.Second):
+		t.Fatal("Expected the rate limited batch to be sent again")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+
+	d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, float64(time.Minute), float64(d), float64(2*time.Second))
+}
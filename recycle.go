@@ -0,0 +1,20 @@
+package zaploki
+
+import (
+	"time"
+)
+
+// recycleConnections closes the idle connections to loki once they are older
+// than ConnMaxAge, so the next request resolves the host again and follows
+// endpoint changes, e.g. loki pods behind a headless service after a rollout
+func (c *Client) recycleConnections() {
+	if c.config.ConnMaxAge <= 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := c.lastRecycle.Load()
+	if now-last < int64(c.config.ConnMaxAge) || !c.lastRecycle.CompareAndSwap(last, now) {
+		return
+	}
+	c.client.CloseIdleConnections()
+}
@@ -0,0 +1,41 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnMaxAge(t *testing.T) {
+	var mu sync.Mutex
+	conns := make(map[string]bool)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conns[r.RemoteAddr] = true
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		ConnMaxAge:   20 * time.Millisecond,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+		assert.NoError(t, c.Flush(ctx))
+		time.Sleep(30 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, conns, 3, "Expected a new connection after ConnMaxAge")
+}
@@ -0,0 +1,172 @@
+package zaploki
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+)
+
+// Patterns of sensitive data for RedactPatterns
+var (
+	// EmailPattern matches email addresses
+	EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// CardNumberPattern matches payment card numbers of 13 to 19 digits,
+	// optionally grouped by spaces or dashes
+	CardNumberPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	// BearerTokenPattern matches bearer tokens and JSON web tokens
+	BearerTokenPattern = regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/-]+=*|\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// defaultRedactReplacement replaces redacted values when RedactReplacement is
+// empty
+const defaultRedactReplacement = "[REDACTED]"
+
+// redacting reports whether any redaction is configured
+func (c *Client) redacting() bool {
+	return len(c.redactFields) > 0 || len(c.config.RedactPatterns) > 0 || c.config.RedactFunc != nil
+}
+
+// scrub applies the redaction and HashFields to entry and to the labels of
+// With or Push, which hold field values as well. The message is read again
+// from the scrubbed line, because label templates use it.
+func (c *Client) scrub(entry logEntry) logEntry {
+	if c.redacting() {
+		c.redact(&entry)
+	}
+	if len(c.hashKeys) > 0 {
+		c.hashFields(&entry)
+	}
+	if msg := stringField(entry.fields, c.lineKeys.message); msg != "" {
+		entry.Message = msg
+	} else if entry.Message != "" {
+		entry.Message = c.scrubValue(c.lineKeys.message, entry.Message)
+	}
+	if len(entry.labels) > 0 {
+		labels := make(map[string]string, len(entry.labels))
+		for k, v := range entry.labels {
+			labels[k] = c.scrubValue(k, v)
+		}
+		entry.labels = labels
+	}
+	return entry
+}
+
+// scrubValue applies the redaction and HashFields to the value of the field
+// key that is not part of a JSON line
+func (c *Client) scrubValue(key, value string) string {
+	switch {
+	case c.redactFields[key]:
+		return c.redactReplacement()
+	case c.hashKeys[key]:
+		return c.hash(value)
+	}
+	value = c.redactString(value)
+	if c.config.RedactFunc != nil {
+		value = c.config.RedactFunc(value)
+	}
+	return value
+}
+
+// redact removes sensitive data from the log line of entry. The values of
+// RedactFields are replaced at any depth of JSON lines and RedactPatterns are
+// replaced in their strings, so the line stays valid JSON. Lines that are not
+// JSON are matched as a whole. RedactFunc is applied last, to the encoded
+// line, which is parsed again if it changed.
+func (c *Client) redact(entry *logEntry) {
+	if entry.fields != nil {
+		for i, f := range entry.fields {
+			if value, ok := c.redactValue(f.key, f.value); ok {
+				entry.fields[i].value = value
+				entry.edited = true
+			}
+		}
+	} else {
+		entry.raw = c.redactString(entry.raw)
+	}
+	if c.config.RedactFunc == nil {
+		return
+	}
+	line := entry.line()
+	if redacted := c.config.RedactFunc(line); redacted != line {
+		entry.raw = redacted
+		entry.parsed = false
+		entry.parse()
+	}
+}
+
+// redactValue returns the redacted value of the field key, and false if it
+// has nothing to redact
+func (c *Client) redactValue(key string, value json.RawMessage) (json.RawMessage, bool) {
+	if c.redactFields[key] {
+		replacement, _ := json.Marshal(c.redactReplacement())
+		return replacement, true
+	}
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return value, false
+	}
+	v, changed := c.redactAny(v)
+	if !changed {
+		return value, false
+	}
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return value, false
+	}
+	return redacted, true
+}
+
+// redactAny redacts a decoded JSON value and reports whether it changed
+func (c *Client) redactAny(v any) (any, bool) {
+	switch v := v.(type) {
+	case string:
+		s := c.redactString(v)
+		return s, s != v
+	case json.Number:
+		// numbers can hold card numbers as well
+		s := c.redactString(string(v))
+		if s == string(v) {
+			return v, false
+		}
+		return s, true
+	case map[string]any:
+		changed := false
+		for k, value := range v {
+			if c.redactFields[k] {
+				v[k] = c.redactReplacement()
+				changed = true
+			} else if value, ok := c.redactAny(value); ok {
+				v[k] = value
+				changed = true
+			}
+		}
+		return v, changed
+	case []any:
+		changed := false
+		for i, value := range v {
+			if value, ok := c.redactAny(value); ok {
+				v[i] = value
+				changed = true
+			}
+		}
+		return v, changed
+	}
+	return v, false
+}
+
+// redactString replaces the matches of RedactPatterns in s
+func (c *Client) redactString(s string) string {
+	for _, p := range c.config.RedactPatterns {
+		s = p.ReplaceAllLiteralString(s, c.redactReplacement())
+	}
+	return s
+}
+
+func (c *Client) redactReplacement() string {
+	if c.config.RedactReplacement != "" {
+		return c.config.RedactReplacement
+	}
+	return defaultRedactReplacement
+}
@@ -0,0 +1,118 @@
+package zaploki
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	c := &Client{
+		config:       &Config{RedactPatterns: []*regexp.Regexp{EmailPattern, CardNumberPattern, BearerTokenPattern}},
+		redactFields: keySet([]string{"password"}),
+	}
+
+	for _, tc := range []struct {
+		line     string
+		redacted string
+	}{
+		{
+			line:     `{"msg":"login by jane@example.com","password":"hunter2","attempt":2}`,
+			redacted: `{"msg":"login by [REDACTED]","password":"[REDACTED]","attempt":2}`,
+		},
+		{
+			line:     `{"msg":"paid","card":4111111111111111,"order":{"number":"4111 1111 1111 1111","password":"x"}}`,
+			redacted: `{"msg":"paid","card":"[REDACTED]","order":{"number":"[REDACTED]","password":"[REDACTED]"}}`,
+		},
+		{
+			line:     `{"headers":["Authorization: Bearer abc.def-123"],"id":42}`,
+			redacted: `{"headers":["Authorization: [REDACTED]"],"id":42}`,
+		},
+		{
+			line:     "plain line from jane@example.com",
+			redacted: "plain line from [REDACTED]",
+		},
+		{
+			line:     `{"msg":"nothing to hide","ids":[1, 2]}`,
+			redacted: `{"msg":"nothing to hide","ids":[1, 2]}`,
+		},
+	} {
+		entry := parseLine([]byte(tc.line))
+		c.redact(&entry)
+		assert.Equal(t, tc.redacted, entry.line())
+	}
+}
+
+func TestRedactBeforeLabels(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:               mockServer.URL,
+		BatchMaxSize:      100,
+		BatchMaxWait:      10 * time.Second,
+		Labels:            map[string]string{"app": "test"},
+		LabelKeys:         []string{"user"},
+		RedactFields:      []string{"user"},
+		RedactPatterns:    []*regexp.Regexp{EmailPattern},
+		RedactReplacement: "***",
+		RedactFunc: func(line string) string {
+			return strings.ReplaceAll(line, "mail", "post")
+		},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "mail to jane@example.com", map[string]any{"user": "jane"}))
+	assert.NoError(t, c.Flush(ctx))
+
+	req := <-received
+	assert.Equal(t, map[string]string{"app": "test", "user": "***"}, req.Streams[0].Stream)
+	assert.Contains(t, req.Streams[0].Values[0][1], `"msg":"post to ***"`)
+}
+
+func TestRedactTemplatedLabels(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:            mockServer.URL,
+		BatchMaxSize:   100,
+		BatchMaxWait:   10 * time.Second,
+		Labels:         map[string]string{"app": "test", "m": "{{.Message}}", "u": `{{.Field "user"}}`},
+		RedactFields:   []string{"user"},
+		RedactPatterns: []*regexp.Regexp{EmailPattern},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "login bob@example.com", map[string]any{"user": "bob"}))
+	assert.NoError(t, c.Flush(ctx))
+
+	req := <-received
+	assert.Equal(t, map[string]string{"app": "test", "m": "login [REDACTED]", "u": "[REDACTED]"}, req.Streams[0].Stream)
+	assert.NotContains(t, req.Streams[0].Values[0][1], "bob")
+}
+
+func TestScrubMessage(t *testing.T) {
+	c := &Client{
+		config:   &Config{RedactPatterns: []*regexp.Regexp{EmailPattern}},
+		lineKeys: defaultLineKeys,
+	}
+	entry := c.scrub(logEntry{Message: "mail from bob@example.com"})
+	assert.Equal(t, "mail from [REDACTED]", entry.Message, "Expected the message of entries without a JSON line to be redacted")
+
+	c = &Client{config: &Config{HashSalt: "secret"}, hashKeys: keySet([]string{"msg"}), lineKeys: defaultLineKeys}
+	entry = c.scrub(parseLine([]byte(`{"msg":"bob"}`)))
+	assert.Equal(t, c.hash("bob"), entry.Message)
+}
@@ -0,0 +1,113 @@
+package zaploki
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// serviceNameLabel is the label that loki 3 groups logs by in its views
+const serviceNameLabel = "service_name"
+
+// detectLabels detects the labels of the environment and the LabelProviders
+// that are enabled in the config. Configured labels override them.
+func (c *Client) detectLabels() {
+	var labels map[string]string
+	if c.config.ServiceName != "" {
+		labels = map[string]string{serviceNameLabel: c.config.ServiceName}
+	}
+	if c.config.AutoLabels {
+		labels = mergeLabels(labels, hostLabels())
+	}
+	if c.config.DetectKubernetes {
+		labels = mergeLabels(labels, KubernetesLabels())
+	}
+	if c.config.DetectCloud {
+		labels = mergeLabels(labels, cloudLabels(c.ctx))
+	}
+	if c.config.LabelsFromEnv != "" {
+		labels = mergeLabels(labels, envLabels(c.config.LabelsFromEnv))
+	}
+	c.environment = labels
+	if len(c.config.LabelProviders) > 0 {
+		provided := c.provideLabels()
+		labels = mergeLabels(labels, provided)
+		if c.config.LabelRefreshInterval > 0 {
+			go c.refreshLabels()
+		}
+	}
+	if _, ok := mergeLabels(labels, c.configured)[serviceNameLabel]; !ok {
+		c.logger.Warn("no service_name label is configured, loki will try to guess it")
+	}
+	c.detected = labels
+}
+
+// envLabels returns a label for every environment variable whose name starts
+// with prefix. The label name is the rest of the variable name in lower case,
+// e.g. LOKI_LABEL_TEAM=payments becomes team="payments" for "LOKI_LABEL_".
+func envLabels(prefix string) map[string]string {
+	var labels map[string]string
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		name, ok := strings.CutPrefix(k, prefix)
+		if !ok || name == "" {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[strings.ToLower(name)] = v
+	}
+	return labels
+}
+
+// hostLabels returns the host, pid and go_version labels of AutoLabels
+func hostLabels() map[string]string {
+	labels := map[string]string{
+		"pid":        strconv.Itoa(os.Getpid()),
+		"go_version": runtime.Version(),
+	}
+	if host, err := os.Hostname(); err == nil {
+		labels["host"] = host
+	}
+	return labels
+}
+
+// serviceAccountNamespace is the file that holds the namespace of a pod
+var serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// KubernetesLabels returns the namespace, pod, container and node_name labels
+// of the pod the process runs in, like promtail's kubernetes discovery adds
+// them. They are read from the POD_NAMESPACE, POD_NAME, CONTAINER_NAME and
+// NODE_NAME environment variables, which can be set with the downward API.
+// The namespace falls back to the service account and the pod name to the
+// hostname. It returns nil outside of kubernetes.
+func KubernetesLabels() map[string]string {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		if b, err := os.ReadFile(serviceAccountNamespace); err == nil {
+			namespace = strings.TrimSpace(string(b))
+		}
+	}
+	pod := os.Getenv("POD_NAME")
+	if pod == "" {
+		pod = os.Getenv("HOSTNAME")
+	}
+	for k, v := range map[string]string{
+		"namespace": namespace,
+		"pod":       pod,
+		"container": os.Getenv("CONTAINER_NAME"),
+		"node_name": os.Getenv("NODE_NAME"),
+	} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
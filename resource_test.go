@@ -0,0 +1,195 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoLabels(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		AutoLabels:   true,
+		Labels:       map[string]string{"host": "override"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	labels := (<-received).Streams[0].Stream
+	assert.Equal(t, "override", labels["host"])
+	assert.Equal(t, strconv.Itoa(os.Getpid()), labels["pid"])
+	assert.Equal(t, runtime.Version(), labels["go_version"])
+}
+
+func TestLabelsFromEnv(t *testing.T) {
+	t.Setenv("LOKI_LABEL_TEAM", "payments")
+	t.Setenv("LOKI_LABEL_REGION", "eu")
+	t.Setenv("LOKI_LABEL_", "ignored")
+	assert.Equal(t, map[string]string{"team": "payments", "region": "eu"}, envLabels("LOKI_LABEL_"))
+
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:           mockServer.URL,
+		BatchMaxSize:  100,
+		BatchMaxWait:  10 * time.Second,
+		LabelsFromEnv: "LOKI_LABEL_",
+		Labels:        map[string]string{"app": "test", "region": "us"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	assert.Equal(t, map[string]string{"app": "test", "team": "payments", "region": "us"}, (<-received).Streams[0].Stream)
+}
+
+func TestKubernetesLabels(t *testing.T) {
+	for _, env := range []string{"KUBERNETES_SERVICE_HOST", "POD_NAMESPACE", "POD_NAME", "CONTAINER_NAME", "NODE_NAME"} {
+		t.Setenv(env, "")
+	}
+	assert.Nil(t, KubernetesLabels(), "Expected no labels outside of kubernetes")
+
+	namespaceFile := filepath.Join(t.TempDir(), "namespace")
+	assert.NoError(t, os.WriteFile(namespaceFile, []byte("prod\n"), 0o600))
+	defer func(file string) { serviceAccountNamespace = file }(serviceAccountNamespace)
+	serviceAccountNamespace = namespaceFile
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("HOSTNAME", "api-7d9f-x2k")
+	t.Setenv("NODE_NAME", "node-1")
+	assert.Equal(t, map[string]string{
+		"namespace": "prod",
+		"pod":       "api-7d9f-x2k",
+		"node_name": "node-1",
+	}, KubernetesLabels())
+}
+
+func TestCloudLabels(t *testing.T) {
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", "")
+	t.Setenv("K_SERVICE", "")
+	defer func(ec2, gce string) { ec2MetadataURL, gceMetadataURL = ec2, gce }(ec2MetadataURL, gceMetadataURL)
+	gceMetadataURL = "http://127.0.0.1:1"
+
+	ec2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			assert.Equal(t, http.MethodPut, r.Method)
+			w.Write([]byte("token"))
+			return
+		}
+		assert.Equal(t, "token", r.Header.Get("X-Aws-Ec2-Metadata-Token"))
+		switch r.URL.Path {
+		case "/latest/meta-data/instance-id":
+			w.Write([]byte("i-0123"))
+		case "/latest/meta-data/placement/region":
+			w.Write([]byte("eu-west-1"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ec2.Close()
+	ec2MetadataURL = ec2.URL
+
+	assert.Equal(t, map[string]string{
+		"cloud_provider":  "aws",
+		"cloud_region":    "eu-west-1",
+		"ec2_instance_id": "i-0123",
+	}, cloudLabels(context.Background()))
+
+	ecs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v4/task", r.URL.Path)
+		w.Write([]byte(`{"TaskARN":"arn:aws:ecs:eu-west-1:1:task/c/1","Cluster":"c","AvailabilityZone":"eu-west-1b"}`))
+	}))
+	defer ecs.Close()
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", ecs.URL+"/v4")
+
+	assert.Equal(t, map[string]string{
+		"cloud_provider": "aws",
+		"cloud_region":   "eu-west-1",
+		"cloud_zone":     "eu-west-1b",
+		"ecs_cluster":    "c",
+		"ecs_task_arn":   "arn:aws:ecs:eu-west-1:1:task/c/1",
+	}, cloudLabels(context.Background()))
+}
+
+func TestLabelProviders(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	var calls atomic.Int32
+	provider := LabelProviderFunc(func(ctx context.Context) (map[string]string, error) {
+		if calls.Add(1) == 1 {
+			return map[string]string{"deployment": "blue", "app": "detected"}, nil
+		}
+		return map[string]string{"deployment": "green"}, nil
+	})
+	c := NewClient(context.Background(), Config{
+		Url:                  mockServer.URL,
+		BatchMaxSize:         100,
+		BatchMaxWait:         10 * time.Second,
+		Labels:               map[string]string{"app": "test"},
+		LabelProviders:       []LabelProvider{provider},
+		LabelRefreshInterval: 10 * time.Millisecond,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "first", nil))
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, map[string]string{"app": "test", "deployment": "blue"}, (<-received).Streams[0].Stream)
+
+	assert.Eventually(t, func() bool { return calls.Load() > 2 }, time.Second, 5*time.Millisecond)
+	assert.NoError(t, c.Push(ctx, "info", "second", nil))
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, map[string]string{"app": "test", "deployment": "green"}, (<-received).Streams[0].Stream)
+}
+
+func TestServiceName(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		ServiceName:  "checkout",
+		Labels:       map[string]string{"env": "dev"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, map[string]string{"env": "dev", "service_name": "checkout"}, (<-received).Streams[0].Stream)
+}
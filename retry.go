@@ -0,0 +1,90 @@
+package zaploki
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultRetryMinBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff = time.Minute
+)
+
+// postWithRetry posts req and retries failed attempts that may succeed later,
+// waiting with exponential backoff between the attempts
+func (c *Client) postWithRetry(ctx context.Context, req lokiPushRequest) error {
+	var reserved int64
+	defer func() {
+		c.retryBudget.release(reserved)
+	}()
+
+	for attempt := 0; ; attempt++ {
+		probe, err := c.breaker.allow()
+		if err != nil {
+			return err
+		}
+		err = c.post(ctx, req)
+		c.breaker.record(err, probe)
+		// a RequestTimeout of the attempt is retried, the end of ctx is not
+		if err == nil || attempt >= c.config.MaxRetries || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		if attempt == 0 {
+			size := req.size()
+			if !c.retryBudget.acquire(size) {
+				return errors.Join(err, ErrRetryBudgetExceeded)
+			}
+			reserved = size
+		}
+		if _, limited := c.rateLimited(err); limited {
+			// the next attempt waits for the rate limit
+			continue
+		}
+
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		}
+	}
+}
+
+// backoff returns the wait before the retry that follows the given attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	minBackoff, maxBackoff := c.config.RetryMinBackoff, c.config.RetryMaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultRetryMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+
+	d := minBackoff
+	for i := 0; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+
+	if jitter := min(max(c.config.RetryJitter, 0), 1); jitter > 0 {
+		// spread retries of many clients by taking off up to jitter of the wait
+		d -= time.Duration(rand.Float64() * jitter * float64(d))
+	}
+	return d
+}
+
+// retryable reports whether a failed request may succeed when it is repeated.
+// Rejected requests are only retried if loki is overloaded. Timeouts are
+// retryable, the caller checks whether its own context is done.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode == http.StatusTooManyRequests || respErr.StatusCode >= 500
+	}
+	return true
+}
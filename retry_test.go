@@ -0,0 +1,131 @@
+package zaploki
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	var attempts int
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    100,
+		BatchMaxWait:    10 * time.Second,
+		MaxRetries:      3,
+		RetryMinBackoff: time.Millisecond,
+	})
+	defer c.Stop()
+
+	assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+	assert.NoError(t, c.Flush(context.Background()), "Expected the retried request to succeed")
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetryTimeouts(t *testing.T) {
+	var attempts atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			// the server only notices the canceled request once the body is read
+			_, _ = io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    100,
+		BatchMaxWait:    10 * time.Second,
+		RequestTimeout:  50 * time.Millisecond,
+		MaxRetries:      3,
+		RetryMinBackoff: time.Millisecond,
+	})
+	defer c.Stop()
+
+	assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+	assert.NoError(t, c.Flush(context.Background()), "Expected timed out attempts to be retried")
+	assert.Equal(t, int32(3), attempts.Load())
+
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+	var attempts atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    100,
+		BatchMaxWait:    10 * time.Second,
+		MaxRetries:      3,
+		RetryMinBackoff: time.Millisecond,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	defer c.Close(ctx)
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.ErrorIs(t, c.Flush(ctx), context.DeadlineExceeded)
+	assert.Equal(t, int32(1), attempts.Load(), "Expected no retry once the context is done")
+}
+
+func TestRetrySkipsClientErrors(t *testing.T) {
+	var attempts int
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    100,
+		BatchMaxWait:    10 * time.Second,
+		MaxRetries:      3,
+		RetryMinBackoff: time.Millisecond,
+	})
+	defer c.Stop()
+
+	assert.NoError(t, c.Push(context.Background(), "info", "test message", nil))
+	assert.Error(t, c.Flush(context.Background()))
+	assert.Equal(t, 1, attempts, "Expected rejected requests not to be retried")
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Client{config: &Config{
+		RetryMinBackoff: 100 * time.Millisecond,
+		RetryMaxBackoff: time.Second,
+	}}
+	assert.Equal(t, 100*time.Millisecond, c.backoff(0))
+	assert.Equal(t, 400*time.Millisecond, c.backoff(2))
+	assert.Equal(t, time.Second, c.backoff(10))
+
+	c.config.RetryJitter = 0.5
+	for i := 0; i < 10; i++ {
+		d := c.backoff(1)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 200*time.Millisecond)
+	}
+}
@@ -0,0 +1,46 @@
+package zaploki
+
+// rewriteLine applies DropFields and RenameFields to the JSON log line of
+// entry. Lines that are not JSON objects are left as they are.
+func (c *Client) rewriteLine(entry *logEntry) {
+	if len(c.dropFields) == 0 && len(c.config.RenameFields) == 0 || entry.fields == nil {
+		return
+	}
+
+	changed := false
+	kept := make([]field, 0, len(entry.fields))
+	renamed := make([]bool, 0, len(entry.fields))
+	var targets map[string]bool
+	for _, f := range entry.fields {
+		if c.dropFields[f.key] {
+			changed = true
+			continue
+		}
+		name, ok := c.config.RenameFields[f.key]
+		if ok {
+			if targets == nil {
+				targets = map[string]bool{}
+			}
+			targets[name] = true
+			f.key = name
+			changed = true
+		}
+		kept = append(kept, f)
+		renamed = append(renamed, ok)
+	}
+	if !changed {
+		return
+	}
+	if len(targets) > 0 {
+		// a renamed field replaces the field that already had its name
+		unique := kept[:0]
+		for i, f := range kept {
+			if renamed[i] || !targets[f.key] {
+				unique = append(unique, f)
+			}
+		}
+		kept = unique
+	}
+	entry.fields = kept
+	entry.edited = true
+}
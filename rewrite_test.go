@@ -0,0 +1,62 @@
+package zaploki
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropFields(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test", "route": `{{.Field "route"}}`},
+		DropFields:   []string{"request_body", "route"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "request done", map[string]any{
+		"request_body": map[string]any{"items": []int{1, 2, 3}},
+		"route":        "/orders",
+		"status":       200,
+	}))
+	assert.NoError(t, c.Push(ctx, "info", "nothing to drop", nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	req := <-received
+	assert.Equal(t, map[string]string{"app": "test", "route": "/orders"}, req.Streams[0].Stream, "Expected templates to read dropped fields")
+	line := req.Streams[0].Values[0][1]
+	assert.NotContains(t, line, "request_body")
+	assert.NotContains(t, line, "/orders")
+	assert.Contains(t, line, `"status":200`)
+	assert.Zero(t, c.buffered.Load(), "Expected the buffered bytes to be released")
+}
+
+func TestRenameFields(t *testing.T) {
+	c := &Client{config: &Config{RenameFields: map[string]string{"msg": "message", "ts": "time", "message": "text"}}}
+	assert.Equal(t, `{"level":"info","time":1,"message":"renamed","text":"kept"}`,
+		rewritten(c, `{"level":"info","ts":1,"msg":"renamed","message":"kept"}`))
+
+	c = &Client{config: &Config{RenameFields: map[string]string{"msg": "message"}}}
+	assert.Equal(t, `{"level":"info","message":"renamed"}`,
+		rewritten(c, `{"level":"info","message":"replaced","msg":"renamed"}`), "Expected the renamed field to replace the existing one")
+	assert.Equal(t, `{"level":"info"}`, rewritten(c, `{"level":"info"}`))
+	assert.Equal(t, "not json", rewritten(c, "not json"))
+}
+
+// rewritten returns line with the DropFields and RenameFields of c applied
+func rewritten(c *Client, line string) string {
+	entry := parseLine([]byte(line))
+	c.rewriteLine(&entry)
+	return entry.line()
+}
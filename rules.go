@@ -0,0 +1,85 @@
+package zaploki
+
+import (
+	"math/rand"
+	"regexp"
+)
+
+// Rule applies an action to the log lines that match it
+type Rule struct {
+	Match  Match
+	Action Action
+}
+
+// Match selects log lines by the value of a field of the JSON line, such as
+// "level", "msg" or a field added with zap. A match without a Field matches
+// every line. Without Value and Regex a line matches if it has the field.
+type Match struct {
+	Field string
+	// Value matches lines whose field has exactly this value
+	Value string
+	// Regex matches lines whose field matches this expression
+	Regex *regexp.Regexp
+}
+
+// Action is applied to the log lines that match a rule
+type Action struct {
+	// SetLabel adds labels to the stream of the line
+	SetLabel map[string]string
+	// SetTenant sends the line to this tenant, see TenantField
+	SetTenant string
+	// Drop discards the line. The rules after it are not evaluated.
+	Drop bool
+	// Sample keeps this fraction of the lines between 0 and 1 and discards
+	// the others. A value of 0 keeps all lines.
+	Sample float64
+}
+
+// ruleValues returns the fields of entry as text for the Rules, which read
+// them before prepare takes any of them out of the line
+func (c *Client) ruleValues(entry logEntry) map[string]string {
+	if len(c.config.Rules) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(entry.fields))
+	for _, f := range entry.fields {
+		values[f.key] = f.text()
+	}
+	return values
+}
+
+// applyRules evaluates the Rules for entry with the values of its fields. It
+// returns false if entry is discarded.
+func (c *Client) applyRules(entry *logEntry, values map[string]string) bool {
+	for _, rule := range c.config.Rules {
+		if !rule.Match.matches(values) {
+			continue
+		}
+		a := rule.Action
+		if a.Drop || (a.Sample > 0 && rand.Float64() >= a.Sample) {
+			return false
+		}
+		entry.labels = mergeLabels(entry.labels, a.SetLabel)
+		if a.SetTenant != "" {
+			entry.tenant = a.SetTenant
+		}
+	}
+	return true
+}
+
+// matches reports whether the fields of a line in values match m
+func (m Match) matches(values map[string]string) bool {
+	if m.Field == "" {
+		return true
+	}
+	value, ok := values[m.Field]
+	switch {
+	case !ok:
+		return false
+	case m.Value != "" && value != m.Value:
+		return false
+	case m.Regex != nil && !m.Regex.MatchString(value):
+		return false
+	}
+	return true
+}
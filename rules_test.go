@@ -0,0 +1,73 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules(t *testing.T) {
+	var mu sync.Mutex
+	var received []lokiPushRequest
+	tenants := make(map[string]bool)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := decodePushRequest(t, r)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, req)
+		tenants[r.Header.Get("X-Scope-OrgID")] = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		Labels:       map[string]string{"app": "test"},
+		Rules: []Rule{
+			{Match: Match{Field: "msg", Regex: regexp.MustCompile("^health")}, Action: Action{Drop: true}},
+			{Match: Match{Field: "level", Value: "error"}, Action: Action{SetLabel: map[string]string{"alert": "true"}}},
+			{Match: Match{Field: "customer"}, Action: Action{SetTenant: "customers"}},
+		},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "healthcheck ok", nil))
+	assert.NoError(t, c.PushEntry(ctx, "error", "failed", nil))
+	assert.NoError(t, c.PushEntry(ctx, "info", "ordered", map[string]any{"customer": "acme"}))
+	assert.NoError(t, c.Flush(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	streams := make(map[string]map[string]string)
+	for _, req := range received {
+		for _, s := range req.Streams {
+			for _, v := range s.Values {
+				streams[parseLine([]byte(v[1])).Message] = s.Stream
+			}
+		}
+	}
+	assert.NotContains(t, streams, "healthcheck ok", "Expected the matching line to be dropped")
+	assert.Equal(t, map[string]string{"app": "test", "alert": "true"}, streams["failed"])
+	assert.Equal(t, map[string]string{"app": "test"}, streams["ordered"])
+	assert.True(t, tenants["customers"], "Expected the line to be sent to the tenant of the rule")
+	assert.Equal(t, uint64(1), c.Stats().Filtered)
+}
+
+func TestRuleSample(t *testing.T) {
+	c := &Client{config: &Config{Rules: []Rule{{Action: Action{Sample: 0.5}}}}}
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		entry := parseLine([]byte(`{"msg":"line"}`))
+		if c.applyRules(&entry, c.ruleValues(entry)) {
+			kept++
+		}
+	}
+	assert.InDelta(t, 500, kept, 100, "Expected about half of the lines to be kept")
+}
@@ -0,0 +1,117 @@
+package zaploki
+
+import (
+	"time"
+)
+
+// SetBatchMaxSize changes BatchMaxSize of a running client
+func (c *Client) SetBatchMaxSize(size int) {
+	c.update(func() {
+		c.config.BatchMaxSize = size
+		c.unbatched.Store(size <= 1)
+		if c.full() {
+			c.dispatchBatch()
+		}
+	})
+}
+
+// SetBatchMaxWait changes BatchMaxWait of a running client. The new wait is
+// measured from the time of the change.
+func (c *Client) SetBatchMaxWait(wait time.Duration) {
+	c.update(func() {
+		c.config.BatchMaxWait = wait
+		c.resetTicker()
+	})
+}
+
+// SetLabels replaces the configured labels that are added to all log lines
+// of a running client. Detected labels are kept unless labels overrides them.
+// Lines that are already batched keep their labels.
+func (c *Client) SetLabels(labels map[string]string) {
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	c.update(func() {
+		c.configured = copied
+		c.applyLabels()
+	})
+}
+
+// SetLabel sets one of the labels that are added to all log lines of a
+// running client. Lines that are already batched keep their labels.
+func (c *Client) SetLabel(key, value string) {
+	c.update(func() {
+		labels := make(map[string]string, len(c.configured)+1)
+		for k, v := range c.configured {
+			labels[k] = v
+		}
+		labels[key] = value
+		c.configured = labels
+		c.applyLabels()
+	})
+}
+
+// DeleteLabel removes one of the configured labels that are added to all log
+// lines of a running client. A detected label of the same name is added
+// again. Lines that are already batched keep their labels.
+func (c *Client) DeleteLabel(key string) {
+	c.update(func() {
+		labels := make(map[string]string, len(c.configured))
+		for k, v := range c.configured {
+			if k != key {
+				labels[k] = v
+			}
+		}
+		c.configured = labels
+		c.applyLabels()
+	})
+}
+
+// applyLabels sets the labels of all log lines to the detected labels,
+// overridden by the configured labels
+func (c *Client) applyLabels() {
+	labels := c.checkLabels(mergeLabels(c.detected, c.configured))
+	c.config.Labels = labels
+	c.labelTemplates = compileLabelTemplates(labels, c.logger)
+}
+
+// update runs fn on the batching loop, which owns the config fields that can
+// be changed at runtime. It does nothing once the client is stopped.
+func (c *Client) update(fn func()) {
+	done := make(chan struct{})
+	select {
+	case c.updates <- func() {
+		fn()
+		close(done)
+	}:
+		<-done
+	case <-c.quit:
+	}
+}
+
+// resetTicker restarts the wait for the next batch, creating or stopping the
+// ticker as BatchMaxWait requires
+func (c *Client) resetTicker() {
+	if c.config.BatchMaxWait <= 0 {
+		if c.ticker != nil {
+			c.ticker.Stop()
+			c.ticker = nil
+		}
+		return
+	}
+	if c.ticker == nil {
+		c.ticker = time.NewTicker(c.config.BatchMaxWait)
+		return
+	}
+	c.ticker.Reset(c.config.BatchMaxWait)
+}
+
+// tick returns the channel of the ticker, or nil to wait forever if there is
+// no ticker
+func (c *Client) tick() <-chan time.Time {
+	if c.ticker == nil {
+		return nil
+	}
+	return c.ticker.C
+}
@@ -0,0 +1,128 @@
+package zaploki
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeSettings(t *testing.T) {
+	received := make(chan lokiPushRequest, 10)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+	})
+	defer c.Stop()
+
+	assert.NoError(t, c.Push(context.Background(), "info", "old labels", nil))
+	c.SetLabels(map[string]string{"app": "renamed"})
+	assert.NoError(t, c.Push(context.Background(), "info", "new labels", nil))
+	c.SetBatchMaxSize(2)
+
+	req := <-received
+	assert.Len(t, req.Streams, 2, "Expected lines to keep the labels they were batched with")
+	assert.Equal(t, map[string]string{"app": "test"}, req.Streams[0].Stream)
+	assert.Equal(t, map[string]string{"app": "renamed"}, req.Streams[1].Stream)
+
+	c.SetBatchMaxWait(10 * time.Millisecond)
+	assert.NoError(t, c.Push(context.Background(), "info", "waited", nil))
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the new wait to be used")
+	}
+}
+
+func TestClientStopsWithParentContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewClient(ctx, Config{
+		Url:          "http://localhost",
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	cancel()
+	c.waitGroup.Wait()
+
+	assert.ErrorIs(t, c.Push(context.Background(), "info", "late", nil), ErrStopped)
+	c.SetBatchMaxSize(10)
+}
+
+func TestSetAndDeleteLabel(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	labels := map[string]string{"app": "test", "role": "follower"}
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       labels,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	c.SetLabel("role", "leader")
+	c.SetLabel("zone", "a")
+	c.DeleteLabel("app")
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	assert.Equal(t, map[string]string{"role": "leader", "zone": "a"}, (<-received).Streams[0].Stream)
+	assert.Equal(t, map[string]string{"app": "test", "role": "follower"}, labels, "Expected the config labels to be kept")
+}
+
+func TestSetLabelsKeepsDetectedLabels(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	var calls atomic.Int32
+	provider := LabelProviderFunc(func(ctx context.Context) (map[string]string, error) {
+		calls.Add(1)
+		return map[string]string{"deployment": "blue"}, nil
+	})
+	c := NewClient(context.Background(), Config{
+		Url:                  mockServer.URL,
+		BatchMaxSize:         100,
+		BatchMaxWait:         10 * time.Second,
+		ServiceName:          "checkout",
+		Labels:               map[string]string{"app": "test"},
+		LabelProviders:       []LabelProvider{provider},
+		LabelRefreshInterval: 10 * time.Millisecond,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	c.SetLabels(map[string]string{"app": "renamed", "deployment": "pinned"})
+	assert.NoError(t, c.Push(ctx, "info", "set labels", nil))
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, map[string]string{"app": "renamed", "deployment": "pinned", "service_name": "checkout"}, (<-received).Streams[0].Stream)
+
+	// refreshed labels don't override the labels that were set
+	calls.Store(0)
+	assert.Eventually(t, func() bool { return calls.Load() > 1 }, time.Second, 5*time.Millisecond)
+	assert.NoError(t, c.Push(ctx, "info", "refreshed", nil))
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, map[string]string{"app": "renamed", "deployment": "pinned", "service_name": "checkout"}, (<-received).Streams[0].Stream)
+
+	c.DeleteLabel("deployment")
+	c.SetLabel("zone", "a")
+	assert.NoError(t, c.Push(ctx, "info", "deleted label", nil))
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, map[string]string{"app": "renamed", "deployment": "blue", "service_name": "checkout", "zone": "a"}, (<-received).Streams[0].Stream)
+}
@@ -0,0 +1,212 @@
+package zaploki
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SigV4 signs the requests to loki with AWS Signature Version 4, for loki
+// behind an ALB or API gateway that authenticates with IAM
+type SigV4 struct {
+	Region string
+	// Service is the service the requests are signed for, "execute-api" by
+	// default
+	Service string
+	// AccessKeyID, SecretAccessKey and SessionToken are static credentials.
+	// Without them the credentials are taken from the AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, the
+	// ECS task role or the EC2 instance role, in that order.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// ecsCredentialsURL is the host of the ECS task role credentials endpoint
+var ecsCredentialsURL = "http://169.254.170.2"
+
+// credentialsExpiryMargin is how long before their expiry role credentials
+// are fetched again
+const credentialsExpiryMargin = 5 * time.Minute
+
+// awsCredentials are the credentials a request is signed with
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+// sigv4Signer signs requests and caches the credentials of the role
+type sigv4Signer struct {
+	cfg *SigV4
+
+	mu          sync.Mutex
+	credentials awsCredentials
+}
+
+// newSigV4Signer returns nil if cfg is nil, which disables signing
+func newSigV4Signer(cfg *SigV4) *sigv4Signer {
+	if cfg == nil {
+		return nil
+	}
+	return &sigv4Signer{cfg: cfg}
+}
+
+// sign adds the SigV4 Authorization header for body to req. All other headers
+// must be set before.
+func (s *sigv4Signer) sign(req *http.Request, body []byte) error {
+	if s == nil {
+		return nil
+	}
+	creds, err := s.get(req.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get aws credentials: %w", err)
+	}
+	service := s.cfg.Service
+	if service == "" {
+		service = "execute-api"
+	}
+	signRequest(req, body, creds, s.cfg.Region, service, time.Now())
+	return nil
+}
+
+// get returns the credentials of the chain described at SigV4
+func (s *sigv4Signer) get(ctx context.Context) (awsCredentials, error) {
+	if s.cfg.AccessKeyID != "" {
+		return awsCredentials{AccessKeyID: s.cfg.AccessKeyID, SecretAccessKey: s.cfg.SecretAccessKey, Token: s.cfg.SessionToken}, nil
+	}
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{AccessKeyID: id, SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), Token: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.credentials.AccessKeyID != "" && time.Now().Before(s.credentials.Expiration.Add(-credentialsExpiryMargin)) {
+		return s.credentials, nil
+	}
+	creds, err := ecsCredentials(ctx)
+	if errors.Is(err, errNoMetadata) {
+		creds, err = ec2Credentials(ctx)
+	}
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	s.credentials = creds
+	return creds, nil
+}
+
+// ecsCredentials reads the credentials of the ECS task role
+func ecsCredentials(ctx context.Context) (awsCredentials, error) {
+	var url string
+	var header http.Header
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		url = ecsCredentialsURL + uri
+	} else if url = os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); url == "" {
+		return awsCredentials{}, errNoMetadata
+	}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		header = http.Header{"Authorization": {token}}
+	}
+	body, err := getMetadata(ctx, http.MethodGet, url, header)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var creds awsCredentials
+	return creds, json.Unmarshal(body, &creds)
+}
+
+// ec2Credentials reads the credentials of the EC2 instance role with IMDSv2
+func ec2Credentials(ctx context.Context) (awsCredentials, error) {
+	token, err := getMetadata(ctx, http.MethodPut, ec2MetadataURL+"/latest/api/token", http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"60"}})
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {string(token)}}
+	role, err := getMetadata(ctx, http.MethodGet, ec2MetadataURL+"/latest/meta-data/iam/security-credentials/", header)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	name, _, _ := strings.Cut(string(role), "\n")
+	body, err := getMetadata(ctx, http.MethodGet, ec2MetadataURL+"/latest/meta-data/iam/security-credentials/"+name, header)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var creds awsCredentials
+	return creds, json.Unmarshal(body, &creds)
+}
+
+// signRequest adds the X-Amz-Date, X-Amz-Security-Token and Authorization
+// headers of SigV4 to req
+func signRequest(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+	for k, v := range req.Header {
+		// like the AWS SDKs, leave out the User-Agent that proxies may change
+		if k = strings.ToLower(k); k != "authorization" && k != "user-agent" {
+			headers[k] = strings.Join(v, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payload := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	hashed := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,51 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignRequest(t *testing.T) {
+	// the get-vanilla example of the AWS SigV4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	assert.NoError(t, err)
+	// proxies may change the User-Agent, so it is not signed
+	req.Header.Set("User-Agent", "zap-loki")
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now, _ := time.Parse(time.RFC3339, "2015-08-30T12:36:00Z")
+	signRequest(req, nil, creds, "us-east-1", "service", now)
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestSigV4RoleCredentials(t *testing.T) {
+	credentials := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "task-token", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"AccessKeyId":"ASIA","SecretAccessKey":"secret","Token":"session","Expiration":"` +
+			time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`))
+	}))
+	defer credentials.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", credentials.URL)
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "task-token")
+
+	headers := requestHeaders(t, Config{SigV4: &SigV4{Region: "eu-west-1"}})
+	assert.True(t, strings.HasPrefix(headers.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIA/"))
+	assert.Contains(t, headers.Get("Authorization"), "/eu-west-1/execute-api/aws4_request")
+	assert.Equal(t, "session", headers.Get("X-Amz-Security-Token"))
+
+	signer := newSigV4Signer(&SigV4{Region: "eu-west-1"})
+	creds, err := signer.get(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "ASIA", creds.AccessKeyID)
+}
@@ -1,9 +1,77 @@
 package zaploki
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// defaultSinkKey is the scheme used when Config.SinkKey is empty. Pushers
+// sharing it are told apart by a per-instance host, e.g. "loki://3".
+const defaultSinkKey = "loki"
+
+// sinks maps a sink URL ("scheme://host") to the pusher currently bound to
+// it. zap offers no way to unregister a sink factory, so every scheme is
+// registered with zap once and its factory looks the pusher up here, which
+// allows a URL to be reused or rebound to a newer pusher.
+var (
+	sinksMu     sync.Mutex
+	sinks       = map[string]*lokiPusher{}
+	sinkSchemes = map[string]bool{}
+	instanceID  atomic.Uint64
 )
 
+// sinkURL returns the zap output path for lp. An explicit SinkKey is used as
+// is, otherwise every pusher gets its own host under the default scheme so
+// several pushers can coexist in one process.
+func (lp *lokiPusher) sinkURL() string {
+	if lp.config.SinkKey != "" {
+		return fmt.Sprintf("%s://", strings.ToLower(lp.config.SinkKey))
+	}
+	return fmt.Sprintf("%s://%d", defaultSinkKey, lp.id)
+}
+
+// bindSink registers the scheme of rawURL with zap on first use and binds
+// rawURL to lp, replacing any pusher that was previously bound to it.
+func bindSink(rawURL string, lp *lokiPusher) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid sink url %q: %w", rawURL, err)
+	}
+
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+
+	if !sinkSchemes[u.Scheme] {
+		if err := zap.RegisterSink(u.Scheme, openSink); err != nil {
+			return fmt.Errorf("failed to register sink %q: %w", u.Scheme, err)
+		}
+		sinkSchemes[u.Scheme] = true
+	}
+	sinks[sinkKey(u)] = lp
+	return nil
+}
+
+func openSink(u *url.URL) (zap.Sink, error) {
+	sinksMu.Lock()
+	lp, ok := sinks[sinkKey(u)]
+	sinksMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no loki pusher bound to sink %q", sinkKey(u))
+	}
+	return lp.Sink(u)
+}
+
+func sinkKey(u *url.URL) string {
+	return fmt.Sprintf("%s://%s", strings.ToLower(u.Scheme), u.Host)
+}
+
 type lokiSink interface {
 	Sync() error
 	Close() error
@@ -21,24 +89,28 @@ func newSink(lp *lokiPusher) lokiSink {
 	}
 }
 
+// Sync sends all pending log lines, including the ones that are still
+// queued, and waits for the request to finish
 func (s sink) Sync() error {
-	if len(s.lokiPusher.logsBatch) > 0 {
-		return s.lokiPusher.send()
+	err := s.lokiPusher.Flush(context.Background())
+	if errors.Is(err, ErrStopped) {
+		// the pending lines were sent when the pusher was stopped
+		return nil
 	}
-	return nil
+	return err
 }
+
 func (s sink) Close() error {
-	s.lokiPusher.Stop()
-	return nil
+	return s.lokiPusher.Close(context.Background())
 }
 
 func (s sink) Write(p []byte) (int, error) {
-	var entry logEntry
-	err := json.Unmarshal(p, &entry)
+	entry, err := s.lokiPusher.lineKeys.decode(p)
 	if err != nil {
 		return 0, err
 	}
-	entry.raw = string(p)
-	s.lokiPusher.entry <- entry
+	if err := s.lokiPusher.enqueue(context.Background(), entry); err != nil {
+		return 0, err
+	}
 	return len(p), nil
 }
@@ -0,0 +1,92 @@
+package zaploki
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// slogHandler renders records with slog's JSON handler and queues the
+// resulting line. Handlers derived through WithAttrs and WithGroup share the
+// buffer of their parent.
+type slogHandler struct {
+	client  *Client
+	handler slog.Handler
+	mu      *sync.Mutex
+	buf     *bytes.Buffer
+}
+
+// SlogHandler returns a slog.Handler that sends records of level info and
+// above to loki. Records are encoded as JSON using the same level, ts and msg
+// keys as zap's production encoder.
+func (c *Client) SlogHandler() slog.Handler {
+	return c.slogHandler(slog.LevelInfo)
+}
+
+// slogHandler returns a handler for the records of level and above
+func (c *Client) slogHandler(level slog.Leveler) slog.Handler {
+	buf := &bytes.Buffer{}
+	return &slogHandler{
+		client: c,
+		handler: slog.NewJSONHandler(buf, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: replaceSlogAttr,
+		}),
+		mu:  &sync.Mutex{},
+		buf: buf,
+	}
+}
+
+func replaceSlogAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.TimeKey:
+		return slog.Float64("ts", epochSeconds(a.Value.Time()))
+	case slog.LevelKey:
+		return slog.String(slog.LevelKey, slogLevel(a.Value.Any().(slog.Level)))
+	}
+	return a
+}
+
+// slogLevel returns the name of l. Levels below info are debug, which
+// includes the verbosity levels of logr.
+func slogLevel(l slog.Level) string {
+	if l < slog.LevelInfo {
+		return "debug"
+	}
+	return strings.ToLower(l.String())
+}
+
+func (h *slogHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.handler.Enabled(ctx, l)
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	h.buf.Reset()
+	err := h.handler.Handle(ctx, r)
+	line := strings.TrimSuffix(h.buf.String(), "\n")
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return h.client.enqueue(ctx, logEntry{
+		Level:   slogLevel(r.Level),
+		Message: r.Message,
+		ts:      r.Time,
+		raw:     line,
+	})
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &slogHandler{client: h.client, handler: h.handler.WithAttrs(attrs), mu: h.mu, buf: h.buf}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	return &slogHandler{client: h.client, handler: h.handler.WithGroup(name), mu: h.mu, buf: h.buf}
+}
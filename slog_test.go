@@ -0,0 +1,78 @@
+package zaploki
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogHandler(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer c.Stop()
+
+	logger := slog.New(c.SlogHandler()).With("app", "test").WithGroup("req")
+	logger.Debug("skipped")
+	logger.Warn("test message", "id", 7)
+	assert.NoError(t, c.Flush(context.Background()))
+
+	req := <-received
+	assert.Len(t, req.Streams, 1, "Expected one stream")
+	assert.Len(t, req.Streams[0].Values, 1, "Expected debug records to be skipped")
+
+	var line map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(req.Streams[0].Values[0][1]), &line))
+	assert.Equal(t, "warn", line["level"])
+	assert.Equal(t, "test message", line["msg"])
+	assert.Equal(t, "test", line["app"])
+	assert.Equal(t, map[string]any{"id": float64(7)}, line["req"])
+	assert.IsType(t, float64(0), line["ts"])
+}
+
+func TestLogSink(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer c.Stop()
+
+	logger := logr.New(c.LogSink(1)).WithName("controller")
+	logger.V(2).Info("skipped")
+	logger.V(1).Info("reconciling")
+	logger.Error(errors.New("boom"), "reconcile failed", "object", "default/app")
+	assert.NoError(t, c.Flush(context.Background()))
+
+	req := <-received
+	assert.Len(t, req.Streams[0].Values, 2, "Expected lines above the verbosity to be skipped")
+
+	var line map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(req.Streams[0].Values[0][1]), &line))
+	assert.Equal(t, "debug", line["level"])
+	assert.Equal(t, "reconciling", line["msg"])
+	assert.NoError(t, json.Unmarshal([]byte(req.Streams[0].Values[1][1]), &line))
+	assert.Equal(t, "error", line["level"])
+	assert.Equal(t, "boom", line["err"])
+	assert.Equal(t, "default/app", line["object"])
+}
@@ -0,0 +1,33 @@
+package zaploki
+
+// Stats counts the log lines that passed through the client
+type Stats struct {
+	// Enqueued is the number of log lines that were pushed to the client
+	Enqueued uint64
+	// Sent is the number of log lines that loki accepted
+	Sent uint64
+	// Dropped is the number of log lines that were dropped because the queue
+	// or MaxBufferedBytes was full
+	Dropped uint64
+	// Failed is the number of log lines in batches that could not be sent
+	Failed uint64
+	// Filtered is the number of log lines that Rules discarded
+	Filtered uint64
+	// Truncated is the number of log lines that were cut to MaxLineBytes.
+	// They are counted as sent or failed as well.
+	Truncated uint64
+}
+
+// Stats returns the number of log lines that were enqueued, sent, dropped,
+// failed, filtered and truncated. Lines that are none of the first five are
+// still pending.
+func (c *Client) Stats() Stats {
+	return Stats{
+		Enqueued:  c.enqueued.Load(),
+		Sent:      c.sent.Load(),
+		Dropped:   c.dropped.Load(),
+		Failed:    c.failed.Load(),
+		Filtered:  c.filtered.Load(),
+		Truncated: c.truncated.Load(),
+	}
+}
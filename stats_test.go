@@ -0,0 +1,44 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	var down atomic.Bool
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    100,
+		BatchMaxWait:    10 * time.Second,
+		CollapseRepeats: true,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.Push(ctx, "info", "repeated", nil))
+	}
+	assert.NoError(t, c.Flush(ctx))
+
+	down.Store(true)
+	assert.NoError(t, c.Push(ctx, "info", "lost", nil))
+	assert.Error(t, c.Flush(ctx))
+
+	assert.Equal(t, Stats{Enqueued: 4, Sent: 3, Failed: 1}, c.Stats())
+}
@@ -0,0 +1,73 @@
+package zaploki
+
+import (
+	"log/slog"
+	"strings"
+	"text/template"
+)
+
+// labelData is the data that label templates are evaluated with
+type labelData struct {
+	Level   string
+	Message string
+	fields  []field
+}
+
+// Field returns the value of a field of the JSON log line, or an empty string
+// if the line doesn't have it
+func (d *labelData) Field(key string) string {
+	value, ok := lookupField(d.fields, key)
+	if !ok {
+		return ""
+	}
+	return field{key: key, value: value}.text()
+}
+
+// compileLabelTemplates returns the templates of the label values that
+// contain one. Values that fail to parse are used as they are.
+func compileLabelTemplates(labels map[string]string, logger *slog.Logger) map[string]*template.Template {
+	var templates map[string]*template.Template
+	for k, v := range labels {
+		if !strings.Contains(v, "{{") {
+			continue
+		}
+		t, err := template.New(k).Option("missingkey=zero").Parse(v)
+		if err != nil {
+			logger.Error("failed to parse label template", slog.String("label", k), slog.Any("error", err))
+			continue
+		}
+		if templates == nil {
+			templates = make(map[string]*template.Template)
+		}
+		templates[k] = t
+	}
+	return templates
+}
+
+// streamLabels returns the labels of the stream of entry. Label templates are
+// evaluated for the entry and labels that resolve to an empty value are left
+// out. Must be called from the batching loop, which owns the labels.
+func (c *Client) streamLabels(entry logEntry) map[string]string {
+	if len(c.labelTemplates) == 0 {
+		return mergeLabels(c.config.Labels, sanitizeLabels(entry.labels))
+	}
+
+	labels := make(map[string]string, len(c.config.Labels)+len(entry.labels))
+	for k, v := range c.config.Labels {
+		labels[k] = v
+	}
+	data := &labelData{Level: entry.Level, Message: entry.Message, fields: entry.fields}
+	var sb strings.Builder
+	for k, t := range c.labelTemplates {
+		sb.Reset()
+		if err := t.Execute(&sb, data); err != nil || sb.Len() == 0 {
+			delete(labels, k)
+			continue
+		}
+		labels[k] = sb.String()
+	}
+	for k, v := range entry.labels {
+		labels[k] = v
+	}
+	return sanitizeLabels(labels)
+}
@@ -0,0 +1,61 @@
+package zaploki
+
+import (
+	"net/http"
+	"sort"
+)
+
+// defaultTenantKey is the header loki reads the tenant from
+const defaultTenantKey = "X-Scope-OrgID"
+
+// tenantKey returns the header that carries the tenant of a request
+func (c *Client) tenantKey() string {
+	if c.config.TenantKey != "" {
+		return c.config.TenantKey
+	}
+	return defaultTenantKey
+}
+
+// setTenant sets the tenant headers of a request for tenant. Without a
+// tenant the TenantKey header is set to TenantValue. X-Scope-OrgID is set to
+// TenantID unless it already holds the tenant.
+func (c *Client) setTenant(req *http.Request, tenant string) {
+	switch {
+	case tenant != "":
+		req.Header.Set(c.tenantKey(), tenant)
+	case c.config.TenantKey != "":
+		req.Header.Set(c.config.TenantKey, c.config.TenantValue)
+	}
+	if c.config.TenantID != "" && req.Header.Get(defaultTenantKey) == "" {
+		req.Header.Set(defaultTenantKey, c.config.TenantID)
+	}
+}
+
+// tenant returns the tenant of the streams of r. Requests are split with
+// byTenant before they are posted, so all streams have the same tenant.
+func (r lokiPushRequest) tenant() string {
+	if len(r.Streams) == 0 {
+		return ""
+	}
+	return r.Streams[0].tenant
+}
+
+// byTenant splits r into one request per tenant, ordered by tenant
+func (r lokiPushRequest) byTenant() []lokiPushRequest {
+	groups := make(map[string]int)
+	var reqs []lokiPushRequest
+	for _, s := range r.Streams {
+		i, ok := groups[s.tenant]
+		if !ok {
+			i = len(reqs)
+			groups[s.tenant] = i
+			reqs = append(reqs, lokiPushRequest{})
+		}
+		reqs[i].Streams = append(reqs[i].Streams, s)
+	}
+	if len(reqs) <= 1 {
+		return []lokiPushRequest{r}
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].tenant() < reqs[j].tenant() })
+	return reqs
+}
@@ -0,0 +1,127 @@
+package zaploki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantField(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := decodePushRequest(t, r)
+		mu.Lock()
+		defer mu.Unlock()
+		tenant := r.Header.Get("X-Scope-OrgID")
+		for _, s := range req.Streams {
+			for _, v := range s.Values {
+				assert.NotContains(t, v[1], "org_id", "Expected the tenant field to be removed")
+				received[tenant] = append(received[tenant], parseLine([]byte(v[1])).Message)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		TenantKey:    "X-Scope-OrgID",
+		TenantValue:  "default",
+		TenantField:  "org_id",
+		Labels:       map[string]string{"app": "test"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.PushEntry(ctx, "info", "first", map[string]any{"org_id": "a"}))
+	assert.NoError(t, c.PushEntry(ctx, "info", "second", map[string]any{"org_id": "b"}))
+	assert.NoError(t, c.PushEntry(ctx, "info", "third", map[string]any{"org_id": "a"}))
+	assert.NoError(t, c.PushEntry(ctx, "info", "fourth", nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string][]string{
+		"a":       {"first", "third"},
+		"b":       {"second"},
+		"default": {"fourth"},
+	}, received, "Expected one request per tenant")
+}
+
+func TestByTenant(t *testing.T) {
+	req := lokiPushRequest{Streams: []stream{
+		{Stream: map[string]string{"app": "a"}, tenant: "b"},
+		{Stream: map[string]string{"app": "b"}, tenant: "a"},
+		{Stream: map[string]string{"app": "c"}, tenant: "b"},
+	}}
+	reqs := req.byTenant()
+	assert.Len(t, reqs, 2)
+	assert.Equal(t, "a", reqs[0].tenant())
+	assert.Len(t, reqs[0].Streams, 1)
+	assert.Equal(t, "b", reqs[1].tenant())
+	assert.Len(t, reqs[1].Streams, 2)
+}
+
+func TestTenantID(t *testing.T) {
+	tenants := make(chan string, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenants <- r.Header.Get("X-Scope-OrgID")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		TenantID:     "team-a",
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, "team-a", <-tenants)
+}
+
+func TestTenantIDWithTenantKey(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	ctx := context.Background()
+	c := NewClient(ctx, Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		TenantID:     "team-a",
+		TenantKey:    "X-Tenant",
+		TenantValue:  "proxy",
+	})
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+	header := <-headers
+	assert.Equal(t, "team-a", header.Get("X-Scope-OrgID"))
+	assert.Equal(t, "proxy", header.Get("X-Tenant"))
+	c.Stop()
+
+	// without a TenantValue the TenantKey header is still sent
+	c = NewClient(ctx, Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		TenantKey:    "X-Tenant",
+	})
+	defer c.Stop()
+	assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	assert.NoError(t, c.Flush(ctx))
+	header = <-headers
+	assert.Contains(t, header, "X-Tenant")
+	assert.Empty(t, header.Get("X-Scope-OrgID"))
+}
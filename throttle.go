@@ -0,0 +1,148 @@
+package zaploki
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// ThrottlePolicy decides what happens to log lines beyond MaxLinesPerSecond
+// or MaxBytesPerSecond
+type ThrottlePolicy int
+
+const (
+	// ThrottleWait delays requests until the rate allows them, keeping the
+	// lines queued meanwhile
+	ThrottleWait ThrottlePolicy = iota
+	// ThrottleDrop sends as many lines of a batch as the rate allows and
+	// drops the rest
+	ThrottleDrop
+	// ThrottleSample sends an evenly spread sample of a batch that the rate
+	// allows and drops the rest
+	ThrottleSample
+)
+
+// tokenBucket allows rate units per second with bursts of up to one second
+type tokenBucket struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// refill adds the tokens since the last call. b.mu must be held.
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// available returns the number of units that may be used right away
+func (b *tokenBucket) available() float64 {
+	if b == nil {
+		return math.Inf(1)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return max(b.tokens, 0)
+}
+
+// take uses n units and returns the wait until the rate allows them
+func (b *tokenBucket) take(n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// throttle applies MaxLinesPerSecond and MaxBytesPerSecond to p before it is
+// sent, by waiting or by dropping lines according to ThrottlePolicy
+func (c *Client) throttle(ctx context.Context, p *pendingRequest) error {
+	if c.lineRate == nil && c.byteRate == nil {
+		return nil
+	}
+	lines, bytes := float64(p.req.lines()), float64(p.req.size())
+
+	if c.config.ThrottlePolicy == ThrottleWait {
+		wait := max(c.lineRate.take(lines), c.byteRate.take(bytes))
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-time.After(wait):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	keep := min(1, c.lineRate.available()/lines, c.byteRate.available()/bytes)
+	if keep < 1 {
+		req, dropped := p.req.sample(keep, c.config.ThrottlePolicy == ThrottleSample)
+		p.req = req
+		p.lines -= dropped
+		c.countDropped(dropped)
+	}
+	c.lineRate.take(float64(p.req.lines()))
+	c.byteRate.take(float64(p.req.size()))
+	return nil
+}
+
+// lines returns the number of lines of r
+func (r lokiPushRequest) lines() int {
+	n := 0
+	for _, s := range r.Streams {
+		n += len(s.Values)
+	}
+	return n
+}
+
+// sample returns r with only the given fraction of its lines and the number
+// of lines that were removed. The lines are spread evenly if spread is set,
+// otherwise the first lines are kept.
+func (r lokiPushRequest) sample(fraction float64, spread bool) (lokiPushRequest, int) {
+	total := r.lines()
+	limit := int(fraction * float64(total))
+
+	var sampled lokiPushRequest
+	i, kept := 0, 0
+	for _, s := range r.Streams {
+		values := make([]streamValue, 0, len(s.Values))
+		for _, v := range s.Values {
+			var ok bool
+			if spread {
+				// keep a line whenever the share of kept lines reaches the
+				// next whole line
+				ok = int(float64(i+1)*fraction) > int(float64(i)*fraction)
+			} else {
+				ok = kept < limit
+			}
+			if ok {
+				values = append(values, v)
+				kept++
+			}
+			i++
+		}
+		if len(values) > 0 {
+			sampled.Streams = append(sampled.Streams, s.withValues(values))
+		}
+	}
+	return sampled, total - kept
+}
@@ -0,0 +1,71 @@
+package zaploki
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleWait(t *testing.T) {
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:               mockServer.URL,
+		BatchMaxSize:      1000,
+		MaxLinesPerSecond: 100,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	for i := 0; i < 150; i++ {
+		assert.NoError(t, c.Push(ctx, "info", "test message", nil))
+	}
+	start := time.Now()
+	assert.NoError(t, c.Flush(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond, "Expected the request to wait for the rate")
+	assert.Equal(t, uint64(150), c.Stats().Sent)
+}
+
+func TestThrottleDrop(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:               mockServer.URL,
+		BatchMaxSize:      1000,
+		MaxLinesPerSecond: 10,
+		ThrottlePolicy:    ThrottleDrop,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, c.Push(ctx, "info", fmt.Sprint(i), nil))
+	}
+	assert.NoError(t, c.Flush(ctx))
+	assert.Len(t, (<-received).Streams[0].Values, 10)
+	assert.Equal(t, Stats{Enqueued: 20, Sent: 10, Dropped: 10}, c.Stats())
+}
+
+func TestPushRequestSample(t *testing.T) {
+	var req lokiPushRequest
+	req.Streams = []stream{{Stream: map[string]string{"app": "test"}}}
+	for i := 0; i < 6; i++ {
+		req.Streams[0].Values = append(req.Streams[0].Values, streamValue{fmt.Sprint(i), fmt.Sprint(i)})
+	}
+
+	sampled, dropped := req.sample(0.5, true)
+	assert.Equal(t, 3, dropped)
+	assert.Equal(t, []streamValue{{"1", "1"}, {"3", "3"}, {"5", "5"}}, sampled.Streams[0].Values)
+
+	first, dropped := req.sample(0.5, false)
+	assert.Equal(t, 3, dropped)
+	assert.Equal(t, []streamValue{{"0", "0"}, {"1", "1"}, {"2", "2"}}, first.Streams[0].Values)
+}
@@ -0,0 +1,81 @@
+package zaploki
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampSource is the time loki stores for a log line
+type TimestampSource int
+
+const (
+	// TimestampEntry uses the time of the entry, as zap or slog recorded it or
+	// as encoded in the time field of the line. Lines without a time get the
+	// time they are passed to the client.
+	TimestampEntry TimestampSource = iota
+	// TimestampSend uses the time the line is passed to the client, for
+	// producers with clocks that can't be trusted
+	TimestampSend
+)
+
+// timeLayouts are the layouts of zap's time encoders that encode strings
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.000Z0700"}
+
+// timeField returns the time in key, or the zero time if it is missing. It
+// reads the output of zap's epoch time encoders in seconds, milliseconds and
+// nanoseconds as well as RFC 3339 and ISO 8601 strings.
+func timeField(fields []field, key string) time.Time {
+	value, ok := lookupField(fields, key)
+	if !ok || key == "" {
+		return time.Time{}
+	}
+	var n json.Number
+	if json.Unmarshal(value, &n) == nil {
+		t, _ := parseEpoch(string(n))
+		return t
+	}
+	s := stringField(fields, key)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseEpoch returns the time of a number of seconds, milliseconds,
+// microseconds or nanoseconds since the epoch. The unit is picked by the
+// magnitude of the number. Decimals are read as digits so no precision is lost
+// to floating point.
+func parseEpoch(s string) (time.Time, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// the units of numbers up to about the year 5000
+	unit, digits := int64(time.Second), 9
+	switch {
+	case f >= 1e17:
+		unit, digits = 1, 0
+	case f >= 1e14:
+		unit, digits = int64(time.Microsecond), 3
+	case f >= 1e11:
+		unit, digits = int64(time.Millisecond), 6
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	n, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || n < 0 || strings.ContainsAny(frac, "eE+-") {
+		return time.Unix(0, int64(f*float64(unit))), true
+	}
+	if len(frac) > digits {
+		frac = frac[:digits]
+	}
+	var nanos int64
+	if frac != "" {
+		nanos, _ = strconv.ParseInt(frac+strings.Repeat("0", digits-len(frac)), 10, 64)
+	}
+	return time.Unix(0, n*unit+nanos), true
+}
@@ -0,0 +1,105 @@
+package zaploki
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseEpoch(t *testing.T) {
+	for _, tc := range []struct {
+		epoch string
+		nanos int64
+	}{
+		{epoch: "1709294400", nanos: 1709294400000000000},
+		{epoch: "1709294400.123456789", nanos: 1709294400123456789},
+		{epoch: "1709294400.5", nanos: 1709294400500000000},
+		{epoch: "1709294400123.456789", nanos: 1709294400123456789},
+		{epoch: "1709294400123456", nanos: 1709294400123456000},
+		{epoch: "1709294400123456789", nanos: 1709294400123456789},
+		{epoch: "1.7092944e9", nanos: 1709294400000000000},
+	} {
+		ts, ok := parseEpoch(tc.epoch)
+		assert.True(t, ok)
+		assert.Equal(t, tc.nanos, ts.UnixNano(), tc.epoch)
+	}
+
+	_, ok := parseEpoch("yesterday")
+	assert.False(t, ok)
+}
+
+func TestTimestampPrecision(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	v := New(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 1,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+	})
+	defer v.Stop()
+
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	assert.NoError(t, v.Hook(zapcore.Entry{Level: zapcore.InfoLevel, Time: ts, Message: "test message"}))
+	assert.Equal(t, "1709294400123456789", (<-received).Streams[0].Values[0][0])
+
+	_, err := v.WriteSyncer().Write([]byte(`{"level":"info","ts":1709294400.987654321,"msg":"test message"}` + "\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1709294400987654321", (<-received).Streams[0].Values[0][0])
+}
+
+func TestTimestampSend(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	v := New(context.Background(), Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    1,
+		BatchMaxWait:    10 * time.Second,
+		Labels:          map[string]string{"app": "test"},
+		TimestampSource: TimestampSend,
+	})
+	defer v.Stop()
+
+	before := time.Now()
+	assert.NoError(t, v.Hook(zapcore.Entry{Level: zapcore.InfoLevel, Time: before.Add(-time.Hour), Message: "test message"}))
+	nanos, err := strconv.ParseInt((<-received).Streams[0].Values[0][0], 10, 64)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, nanos, before.UnixNano(), "Expected the time the line was passed to the client")
+}
+
+func TestCoreTimestampPrecision(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	v := New(context.Background(), Config{
+		Url:           mockServer.URL,
+		BatchMaxSize:  1,
+		BatchMaxWait:  10 * time.Second,
+		Labels:        map[string]string{"app": "test"},
+		EncoderConfig: &cfg,
+	})
+	defer v.Stop()
+
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	core := v.Core(zapcore.InfoLevel)
+	assert.NoError(t, core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Time: ts, Message: "test message"}, nil))
+	assert.Equal(t, "1709294400123456789", (<-received).Streams[0].Values[0][0])
+}
@@ -0,0 +1,122 @@
+package zaploki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig configures the TLS connections to loki
+type TLSConfig struct {
+	// CAFile is a PEM file of the certificate authorities that loki's
+	// certificate is verified with instead of the system ones
+	CAFile string
+	// CA holds PEM encoded certificate authorities like CAFile
+	CA []byte
+	// ServerName is the name loki's certificate is verified for, if it
+	// differs from the host of Url
+	ServerName string
+	// InsecureSkipVerify accepts any certificate. Only use it for testing.
+	InsecureSkipVerify bool
+	// CertFile and KeyFile are the PEM files of a client certificate for
+	// mutual TLS. They are read again when they change, so renewed
+	// certificates are used for new connections.
+	CertFile string
+	KeyFile  string
+	// Cert and Key hold a PEM encoded client certificate like CertFile and
+	// KeyFile
+	Cert []byte
+	Key  []byte
+}
+
+// build returns the tls.Config of t
+func (t *TLSConfig) build() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" || len(t.CA) > 0 {
+		ca := t.CA
+		if t.CAFile != "" {
+			b, err := os.ReadFile(t.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file: %w", err)
+			}
+			ca = append(append([]byte{}, ca...), b...)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no certificates found in CA")
+		}
+		cfg.RootCAs = pool
+	}
+
+	switch {
+	case t.CertFile != "" || t.KeyFile != "":
+		cert := &clientCert{certFile: t.CertFile, keyFile: t.KeyFile}
+		if _, err := cert.get(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.get()
+		}
+	case len(t.Cert) > 0 || len(t.Key) > 0:
+		cert, err := tls.X509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// clientCert loads a client certificate from files and reloads it when the
+// files change
+type clientCert struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// get returns the current certificate. If the files changed but can't be
+// loaded, e.g. while they are being replaced, the previous one is kept.
+func (c *clientCert) get() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime, err := c.lastModified()
+	if err == nil && c.cert != nil && !modTime.After(c.modTime) {
+		return c.cert, nil
+	}
+	cert, loadErr := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if loadErr != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load client certificate: %w", loadErr)
+	}
+	c.cert, c.modTime = &cert, modTime
+	return c.cert, nil
+}
+
+// lastModified returns the later modification time of the files
+func (c *clientCert) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
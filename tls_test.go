@@ -0,0 +1,138 @@
+package zaploki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLS(t *testing.T) {
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mockServer.Certificate().Raw})
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, ca, 0o600))
+
+	for _, tc := range []struct {
+		name string
+		tls  *TLSConfig
+		ok   bool
+	}{
+		{name: "system roots", tls: nil, ok: false},
+		{name: "ca", tls: &TLSConfig{CA: ca}, ok: true},
+		{name: "ca file", tls: &TLSConfig{CAFile: caFile}, ok: true},
+		{name: "wrong server name", tls: &TLSConfig{CA: ca, ServerName: "loki.internal"}, ok: false},
+		{name: "insecure", tls: &TLSConfig{InsecureSkipVerify: true}, ok: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewClient(context.Background(), Config{Url: mockServer.URL, TLS: tc.tls})
+			defer c.Stop()
+			err := c.CheckConnection(context.Background())
+			if tc.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+// clientCertificate returns a self signed client certificate and its key as
+// PEM
+func clientCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestMutualTLS(t *testing.T) {
+	cert, key := clientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(cert)
+
+	mockServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mockServer.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	mockServer.StartTLS()
+	defer mockServer.Close()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, cert, 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, key, 0o600))
+
+	for _, tc := range []struct {
+		name string
+		tls  *TLSConfig
+		ok   bool
+	}{
+		{name: "no certificate", tls: &TLSConfig{InsecureSkipVerify: true}, ok: false},
+		{name: "pem", tls: &TLSConfig{InsecureSkipVerify: true, Cert: cert, Key: key}, ok: true},
+		{name: "files", tls: &TLSConfig{InsecureSkipVerify: true, CertFile: certFile, KeyFile: keyFile}, ok: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewClient(context.Background(), Config{Url: mockServer.URL, TLS: tc.tls})
+			defer c.Stop()
+			err := c.CheckConnection(context.Background())
+			if tc.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestClientCertReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	write := func(modTime time.Time) []byte {
+		cert, key := clientCertificate(t)
+		assert.NoError(t, os.WriteFile(certFile, cert, 0o600))
+		assert.NoError(t, os.WriteFile(keyFile, key, 0o600))
+		assert.NoError(t, os.Chtimes(certFile, modTime, modTime))
+		assert.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+		block, _ := pem.Decode(cert)
+		return block.Bytes
+	}
+
+	c := &clientCert{certFile: certFile, keyFile: keyFile}
+	first := write(time.Now().Add(-time.Minute))
+	cert, err := c.get()
+	assert.NoError(t, err)
+	assert.Equal(t, first, cert.Certificate[0])
+
+	second := write(time.Now())
+	cert, err = c.get()
+	assert.NoError(t, err)
+	assert.Equal(t, second, cert.Certificate[0], "Expected the changed files to be loaded again")
+}
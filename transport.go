@@ -0,0 +1,53 @@
+package zaploki
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// newHTTPClient returns the HTTPClient of cfg, or a client with the Transport
+// of cfg or a transport built from its settings
+func newHTTPClient(cfg *Config, logger *slog.Logger) *http.Client {
+	if cfg.HTTPClient != nil {
+		return cfg.HTTPClient
+	}
+	if cfg.Transport != nil {
+		return &http.Client{Transport: cfg.Transport}
+	}
+
+	// an own transport, so closing its idle connections doesn't affect others.
+	// Like the default one it uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+		transport.MaxIdleConns = max(transport.MaxIdleConns, cfg.MaxIdleConnsPerHost)
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	transport.DisableKeepAlives = cfg.DisableKeepAlives
+	if cfg.DisableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			logger.Error("invalid proxy url", slog.Any("error", err))
+		} else {
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+	}
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.build()
+		if err != nil {
+			logger.Error("invalid TLS config", slog.Any("error", err))
+		} else {
+			transport.TLSClientConfig = tlsConfig
+		}
+	}
+	dialUnixSockets(transport, cfg)
+	return &http.Client{Transport: transport}
+}
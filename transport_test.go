@@ -0,0 +1,71 @@
+package zaploki
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingTransport counts the requests it sends
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	req.Header.Set("X-Instrumented", "true")
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestHTTPClient(t *testing.T) {
+	transport := &countingTransport{}
+	headers := requestHeaders(t, Config{HTTPClient: &http.Client{Transport: transport}})
+	assert.Equal(t, "true", headers.Get("X-Instrumented"))
+	assert.Equal(t, int32(1), transport.requests.Load())
+
+	transport = &countingTransport{}
+	headers = requestHeaders(t, Config{Transport: transport})
+	assert.Equal(t, "true", headers.Get("X-Instrumented"))
+	assert.Equal(t, int32(1), transport.requests.Load())
+}
+
+func TestProxyURL(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		assert.Equal(t, "http://loki.invalid/loki/api/v1/push", r.URL.String(), "Expected the proxy to get the full url")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	c := NewClient(context.Background(), Config{Url: "http://loki.invalid", ProxyURL: proxy.URL})
+	defer c.Stop()
+	assert.NoError(t, c.CheckConnection(context.Background()))
+	assert.Equal(t, int32(1), proxied.Load())
+}
+
+func TestTransportSettings(t *testing.T) {
+	client := newHTTPClient(&Config{
+		MaxIdleConnsPerHost: 64,
+		IdleConnTimeout:     time.Minute,
+		DisableKeepAlives:   true,
+		DisableHTTP2:        true,
+	}, slog.Default())
+	transport := client.Transport.(*http.Transport)
+	assert.Equal(t, 64, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 100, transport.MaxIdleConns)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.True(t, transport.DisableKeepAlives)
+	assert.False(t, transport.ForceAttemptHTTP2)
+	assert.NotNil(t, transport.TLSNextProto)
+
+	transport = newHTTPClient(&Config{}, slog.Default()).Transport.(*http.Transport)
+	assert.True(t, transport.ForceAttemptHTTP2, "Expected HTTP/2 by default")
+	assert.NotSame(t, http.DefaultTransport, transport)
+}
@@ -0,0 +1,30 @@
+package zaploki
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// truncateLine shortens line to at most max bytes, ending with a marker that
+// holds the original size. Lines are cut at a character boundary, so the
+// result may be a few bytes shorter.
+func truncateLine(line string, max int) string {
+	if max <= 0 || len(line) <= max {
+		return line
+	}
+	marker := fmt.Sprintf("…truncated (%d bytes)", len(line))
+	cut := max - len(marker)
+	if cut < 0 {
+		// MaxLineBytes is too small for the marker
+		return line[:runeStart(line, max)]
+	}
+	return line[:runeStart(line, cut)] + marker
+}
+
+// runeStart returns the largest index up to i that starts a character of s
+func runeStart(s string, i int) int {
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,56 @@
+package zaploki
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateLine(t *testing.T) {
+	assert.Equal(t, "short", truncateLine("short", 10))
+	assert.Equal(t, "unlimited", truncateLine("unlimited", 0))
+
+	line := truncateLine(strings.Repeat("a", 100), 40)
+	assert.Equal(t, strings.Repeat("a", 16)+"…truncated (100 bytes)", line)
+	assert.Len(t, line, 40)
+
+	line = truncateLine(strings.Repeat("é", 50), 40)
+	assert.True(t, utf8.ValidString(line), "Expected the line to be cut at a character boundary")
+	assert.LessOrEqual(t, len(line), 40)
+	assert.True(t, strings.HasSuffix(line, "…truncated (100 bytes)"))
+
+	assert.Equal(t, "aaaaa", truncateLine(strings.Repeat("a", 100), 5), "Expected no marker if it doesn't fit")
+}
+
+func TestMaxLineBytes(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+		MaxLineBytes: 64,
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "short", nil))
+	assert.NoError(t, c.Push(ctx, "info", strings.Repeat("x", 200), nil))
+	assert.NoError(t, c.Flush(ctx))
+
+	values := (<-received).Streams[0].Values
+	assert.Contains(t, values[0][1], `"msg":"short"`)
+	assert.LessOrEqual(t, len(values[1][1]), 64)
+	assert.Contains(t, values[1][1], "…truncated")
+	assert.Equal(t, uint64(1), c.Stats().Truncated)
+	assert.Zero(t, c.buffered.Load(), "Expected the buffered bytes to be released")
+}
@@ -0,0 +1,62 @@
+package zaploki
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// parseUnixURL splits a url like unix:///run/loki.sock or
+// unix:///run/loki.sock:/prefix into the socket and the HTTP path. It returns
+// false for other urls.
+func parseUnixURL(u string) (socket, path string, ok bool) {
+	rest, ok := strings.CutPrefix(u, "unix://")
+	if !ok {
+		return "", "", false
+	}
+	socket, path, _ = strings.Cut(rest, ":")
+	return socket, path, true
+}
+
+// unixHost returns the host that stands for socket in the urls of requests.
+// The transport dials the socket for it.
+func unixHost(socket string) string {
+	h := fnv.New64a()
+	h.Write([]byte(socket))
+	return fmt.Sprintf("unix-%x", h.Sum64())
+}
+
+// dialUnixSockets makes transport dial the unix sockets of the loki urls of
+// cfg instead of resolving their hosts, and not send them through a proxy
+func dialUnixSockets(transport *http.Transport, cfg *Config) {
+	sockets := make(map[string]string)
+	for _, u := range append([]string{cfg.Url}, cfg.Urls...) {
+		if socket, _, ok := parseUnixURL(u); ok {
+			sockets[unixHost(socket)] = socket
+		}
+	}
+	if len(sockets) == 0 {
+		return
+	}
+
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, _ := net.SplitHostPort(addr)
+		if socket, ok := sockets[host]; ok {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		return dial(ctx, network, addr)
+	}
+	proxy := transport.Proxy
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if _, ok := sockets[req.URL.Hostname()]; ok || proxy == nil {
+			return nil, nil
+		}
+		return proxy(req)
+	}
+}
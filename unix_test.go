@@ -0,0 +1,42 @@
+package zaploki
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "loki")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "loki.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+
+	paths := make(chan string, 2)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	for _, tc := range []struct {
+		url  string
+		path string
+	}{
+		{url: "unix://" + socket, path: "/loki/api/v1/push"},
+		{url: "unix://" + socket + ":/gateway", path: "/gateway/loki/api/v1/push"},
+	} {
+		c := NewClient(context.Background(), Config{Url: tc.url, ProxyURL: "http://localhost:1"})
+		assert.NoError(t, c.CheckConnection(context.Background()))
+		assert.Equal(t, tc.path, <-paths)
+		c.Stop()
+	}
+}
@@ -0,0 +1,33 @@
+package zaploki
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+const modulePath = "github.com/paul-milne/zap-loki"
+
+// DefaultUserAgent returns the User-Agent that requests are sent with, e.g.
+// "zap-loki/v1.2.0". Append to it in UserAgent to identify a service.
+var DefaultUserAgent = sync.OnceValue(func() string {
+	version := "devel"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Path == modulePath && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				version = dep.Version
+			}
+		}
+	}
+	return "zap-loki/" + version
+})
+
+// userAgent returns the User-Agent of the requests to loki
+func (c *Client) userAgent() string {
+	if c.config.UserAgent != "" {
+		return c.config.UserAgent
+	}
+	return DefaultUserAgent()
+}
@@ -0,0 +1,108 @@
+package zaploki
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateLabels checks labels against the naming rules of loki, which
+// rejects pushes with invalid labels. Names must match
+// [a-zA-Z_][a-zA-Z0-9_]*, must not start with __ and values must be non
+// empty UTF-8. The client sanitizes invalid labels instead of failing, so
+// ValidateLabels can be used to reject them at startup.
+func ValidateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if err := validateLabel(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateLabel(name, value string) error {
+	switch {
+	case !validLabelName(name):
+		return fmt.Errorf("invalid label name %q", name)
+	case value == "":
+		return fmt.Errorf("label %q has an empty value", name)
+	case !utf8.ValidString(value):
+		return fmt.Errorf("label %q has an invalid UTF-8 value", name)
+	}
+	return nil
+}
+
+func validLabelName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "__") {
+		return false
+	}
+	for i, r := range name {
+		if !labelNameRune(r, i) {
+			return false
+		}
+	}
+	return true
+}
+
+func labelNameRune(r rune, i int) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')
+}
+
+// sanitizeLabelName replaces the characters of name that loki doesn't allow
+// with underscores
+func sanitizeLabelName(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		if i == 0 && r >= '0' && r <= '9' {
+			sb.WriteByte('_')
+		}
+		if labelNameRune(r, 1) {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	s := sb.String()
+	for strings.HasPrefix(s, "__") {
+		s = s[1:]
+	}
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+// sanitizeLabels returns labels with invalid names replaced and labels with
+// empty values removed. labels is returned as is if all labels are valid.
+func sanitizeLabels(labels map[string]string) map[string]string {
+	if ValidateLabels(labels) == nil {
+		return labels
+	}
+	sanitized := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if v == "" {
+			continue
+		}
+		if !validLabelName(k) {
+			k = sanitizeLabelName(k)
+		}
+		sanitized[k] = strings.ToValidUTF8(v, "�")
+	}
+	return sanitized
+}
+
+// checkLabels sanitizes configured labels and logs the labels that were
+// invalid
+func (c *Client) checkLabels(labels map[string]string) map[string]string {
+	for k, v := range labels {
+		if strings.Contains(v, "{{") {
+			// templates are checked once they are evaluated
+			v = "template"
+		}
+		if err := validateLabel(k, v); err != nil {
+			c.logger.Warn("sanitizing invalid label", slog.Any("error", err))
+		}
+	}
+	return sanitizeLabels(labels)
+}
@@ -0,0 +1,43 @@
+package zaploki
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, ValidateLabels(map[string]string{"app": "test", "_env2": "dev"}))
+	assert.Error(t, ValidateLabels(map[string]string{"my app": "test"}))
+	assert.Error(t, ValidateLabels(map[string]string{"1app": "test"}))
+	assert.Error(t, ValidateLabels(map[string]string{"__name__": "test"}))
+	assert.Error(t, ValidateLabels(map[string]string{"app": ""}))
+}
+
+func TestSanitizeLabels(t *testing.T) {
+	labels := map[string]string{"my app": "test", "1st": "a", "__reserved": "b", "empty": "", "ok": "c"}
+	assert.Equal(t, map[string]string{"my_app": "test", "_1st": "a", "_reserved": "b", "ok": "c"}, sanitizeLabels(labels))
+}
+
+func TestClientSanitizesLabels(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"service.name": "test"},
+	})
+	defer c.Stop()
+
+	ctx := context.Background()
+	assert.NoError(t, c.Push(ctx, "info", "test message", map[string]string{"job-id": "1", "empty": ""}))
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, map[string]string{"service_name": "test", "job_id": "1"}, (<-received).Streams[0].Stream)
+}
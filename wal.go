@@ -0,0 +1,215 @@
+package zaploki
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ReplayOrder decides in which order the batches found in QueueDir on start
+// are sent
+type ReplayOrder int
+
+const (
+	// ReplayOldestFirst sends the oldest batches first
+	ReplayOldestFirst ReplayOrder = iota
+	// ReplayNewestFirst sends the most recent batches first, so current logs
+	// show up in loki before the backlog
+	ReplayNewestFirst
+)
+
+const walSuffix = ".wal"
+
+// wal writes the log lines of every batch to a segment file in QueueDir, so
+// they survive a restart of the process. Lines are appended when the run loop
+// adds them to the batch, and a segment is synced to disk when its batch is
+// taken for sending. A segment is removed once its batch is sent.
+type wal struct {
+	dir      string
+	maxBytes int64
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	seq     uint64
+	current *os.File
+	name    string
+	// sizes holds the size of every segment on disk, by name
+	sizes map[string]int64
+	total int64
+}
+
+// segment is a file of the queue together with the batch it holds
+type segment struct {
+	name string
+	req  lokiPushRequest
+}
+
+// openWAL opens the queue in dir and returns the segments that were left by
+// a previous process, oldest first
+func openWAL(dir string, maxBytes int64, logger *slog.Logger) (*wal, []segment, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+walSuffix))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(names)
+
+	w := &wal{dir: dir, maxBytes: maxBytes, logger: logger, sizes: make(map[string]int64)}
+	var segments []segment
+	for _, name := range names {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), walSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.seq = max(w.seq, seq)
+
+		req, size, err := readSegment(name)
+		if err != nil {
+			w.logger.Error("failed to read queue segment", slog.String("segment", name), slog.Any("error", err))
+			continue
+		}
+		if len(req.Streams) == 0 {
+			os.Remove(name)
+			continue
+		}
+		w.sizes[name] = size
+		w.total += size
+		segments = append(segments, segment{name: name, req: req})
+	}
+	return w, segments, nil
+}
+
+// readSegment reads the lines of a segment into a push request
+func readSegment(name string) (lokiPushRequest, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return lokiPushRequest{}, 0, err
+	}
+	defer f.Close()
+
+	b := newBatch()
+	var size int64
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		size += int64(len(scanner.Bytes())) + 1
+		var s storedStream
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			// the process may have stopped in the middle of a line
+			continue
+		}
+		for _, v := range s.Values {
+			b.add(s.Tenant, s.Stream, v, "")
+		}
+	}
+	return b.request(), size, scanner.Err()
+}
+
+// storedStream is a stream as it is written to disk, with its tenant
+type storedStream struct {
+	Tenant string `json:"tenant,omitempty"`
+	stream
+}
+
+// append writes v to the current segment, starting a new segment if needed
+func (w *wal) append(tenant string, labels map[string]string, v streamValue) {
+	if w == nil {
+		return
+	}
+	line, err := json.Marshal(storedStream{Tenant: tenant, stream: stream{Stream: labels, Values: []streamValue{v}}})
+	if err != nil {
+		w.logger.Error("failed to encode queue line", slog.Any("error", err))
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.current == nil {
+		w.seq++
+		w.name = filepath.Join(w.dir, fmt.Sprintf("%020d%s", w.seq, walSuffix))
+		if w.current, err = os.OpenFile(w.name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600); err != nil {
+			w.logger.Error("failed to create queue segment", slog.Any("error", err))
+			return
+		}
+	}
+	n, err := w.current.Write(append(line, '\n'))
+	w.sizes[w.name] += int64(n)
+	w.total += int64(n)
+	if err != nil {
+		w.logger.Error("failed to write queue line", slog.Any("error", err))
+	}
+	w.trim()
+}
+
+// rotate syncs and closes the current segment and returns its name. The
+// lines appended afterwards go to a new segment.
+func (w *wal) rotate() string {
+	if w == nil {
+		return ""
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.current == nil {
+		return ""
+	}
+	if err := w.current.Sync(); err != nil {
+		w.logger.Error("failed to sync queue segment", slog.Any("error", err))
+	}
+	w.current.Close()
+	w.current = nil
+	return w.name
+}
+
+// remove deletes a segment whose batch is done
+func (w *wal) remove(name string) {
+	if w == nil || name == "" {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.removeLocked(name)
+}
+
+func (w *wal) removeLocked(name string) {
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		w.logger.Error("failed to remove queue segment", slog.Any("error", err))
+	}
+	w.total -= w.sizes[name]
+	delete(w.sizes, name)
+}
+
+// trim removes the oldest closed segments while the queue uses more than
+// maxBytes. w.mu must be held.
+func (w *wal) trim() {
+	if w.maxBytes <= 0 || w.total <= w.maxBytes {
+		return
+	}
+	names := make([]string, 0, len(w.sizes))
+	for name := range w.sizes {
+		if name != w.name || w.current == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if w.total <= w.maxBytes {
+			return
+		}
+		w.logger.Warn("queue directory is full, removing oldest segment", slog.String("segment", name))
+		w.removeLocked(name)
+	}
+}
+
+// close closes the current segment, keeping it for the next process
+func (w *wal) close() {
+	w.rotate()
+}
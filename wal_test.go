@@ -0,0 +1,161 @@
+package zaploki
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueDirSurvivesRestart(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	received := make(chan lokiPushRequest, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- decodePushRequest(t, r)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	cfg := Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		QueueDir:     t.TempDir(),
+		Labels:       map[string]string{"app": "test"},
+	}
+	c := NewClient(context.Background(), cfg)
+	assert.NoError(t, c.Push(context.Background(), "error", "sent after restart", nil))
+	assert.Error(t, c.Close(context.Background()))
+
+	down.Store(false)
+	c = NewClient(context.Background(), cfg)
+	defer c.Stop()
+
+	select {
+	case req := <-received:
+		assert.Equal(t, map[string]string{"app": "test"}, req.Streams[0].Stream)
+		assert.Contains(t, req.Streams[0].Values[0][1], "sent after restart")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the queued batch to be sent on start")
+	}
+
+	assert.Eventually(t, func() bool {
+		segments, _ := filepath.Glob(filepath.Join(cfg.QueueDir, "*.wal"))
+		return len(segments) == 0
+	}, time.Second, 10*time.Millisecond, "Expected sent batches to be removed from the queue")
+}
+
+func TestQueueDirRetriesFailedBatches(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	received := make(chan lokiPushRequest, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- decodePushRequest(t, r)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer mockServer.Close()
+
+	cfg := Config{
+		Url:             mockServer.URL,
+		BatchMaxSize:    100,
+		BatchMaxWait:    10 * time.Second,
+		QueueDir:        t.TempDir(),
+		RetryMinBackoff: 50 * time.Millisecond,
+		Labels:          map[string]string{"app": "test"},
+	}
+	c := NewClient(context.Background(), cfg)
+	defer c.Stop()
+	assert.NoError(t, c.Push(context.Background(), "error", "sent once loki is back", nil))
+	assert.Error(t, c.Flush(context.Background()))
+
+	down.Store(false)
+	select {
+	case req := <-received:
+		assert.Contains(t, req.Streams[0].Values[0][1], "sent once loki is back")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the failed batch to be sent again")
+	}
+	assert.Eventually(t, func() bool {
+		segments, _ := filepath.Glob(filepath.Join(cfg.QueueDir, "*.wal"))
+		return len(segments) == 0 && c.Stats().Sent == 1
+	}, time.Second, 10*time.Millisecond, "Expected the sent batch to be removed from the queue")
+	assert.Zero(t, c.Stats().Failed, "Expected the retried batch not to count as failed")
+}
+
+func TestQueueDirRemovesRejectedBatches(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	var requests atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer mockServer.Close()
+
+	cfg := Config{
+		Url:            mockServer.URL,
+		BatchMaxSize:   100,
+		BatchMaxWait:   10 * time.Second,
+		QueueDir:       t.TempDir(),
+		DeadLetterFile: filepath.Join(t.TempDir(), "dead.jsonl"),
+		Labels:         map[string]string{"app": "test"},
+	}
+	c := NewClient(context.Background(), cfg)
+	assert.NoError(t, c.Push(context.Background(), "error", "rejected after restart", nil))
+	assert.Error(t, c.Close(context.Background()))
+
+	down.Store(false)
+	c = NewClient(context.Background(), cfg)
+	assert.Eventually(t, func() bool {
+		segments, _ := filepath.Glob(filepath.Join(cfg.QueueDir, "*.wal"))
+		return len(segments) == 0 && c.Stats().Failed == 1
+	}, 5*time.Second, 10*time.Millisecond, "Expected the rejected batch to be removed from the queue")
+	assert.NoError(t, c.Close(context.Background()))
+	assert.Equal(t, int32(1), requests.Load())
+
+	dead, err := os.ReadFile(cfg.DeadLetterFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(dead), "rejected after restart")
+
+	// the rejected batch is not replayed again
+	c = NewClient(context.Background(), cfg)
+	assert.NoError(t, c.Close(context.Background()))
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestQueueMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	w, _, err := openWAL(dir, 200, slog.Default())
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		w.append("", map[string]string{"app": "test"}, streamValue{"1", "a log line that takes up some space"})
+		w.rotate()
+	}
+	w.close()
+
+	_, segments, err := openWAL(dir, 200, slog.Default())
+	assert.NoError(t, err)
+	assert.Less(t, len(segments), 5, "Expected the oldest segments to be removed")
+	assert.NotEmpty(t, segments)
+}
@@ -0,0 +1,77 @@
+package zaploki
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// lineWriter splits its input into lines and queues every line as one log
+// entry. Lines that are JSON objects are parsed for their level and
+// timestamp, anything else is sent as is.
+type lineWriter struct {
+	client *Client
+	mu     sync.Mutex
+	buf    []byte
+}
+
+// Writer returns an io.Writer that sends every newline terminated line
+// written to it to loki. It can be used as the output of logging libraries
+// such as zerolog, logrus or the standard library log package.
+func (c *Client) Writer() io.Writer {
+	return &lineWriter{client: c}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	rest := w.buf
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimSpace(rest[:i])
+		rest = rest[i+1:]
+		if len(line) == 0 {
+			continue
+		}
+		if err := w.client.enqueue(context.Background(), w.client.lineKeys.parseLine(line)); err != nil {
+			return 0, err
+		}
+	}
+	w.buf = append(w.buf[:0], rest...)
+
+	return len(p), nil
+}
+
+// stdWriter pushes every write as one message, which matches how log.Logger
+// writes its output.
+type stdWriter struct {
+	client *Client
+	level  string
+	labels map[string]string
+}
+
+// StdLogger returns a log.Logger from the standard library that sends its
+// output to loki at the given level, with labels added to the configured
+// ones. It can be used where APIs expect a *log.Logger such as
+// http.Server.ErrorLog.
+func (c *Client) StdLogger(level zapcore.Level, labels map[string]string) *log.Logger {
+	return log.New(&stdWriter{client: c, level: level.String(), labels: labels}, "", 0)
+}
+
+func (w *stdWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	if err := w.client.Push(context.Background(), w.level, msg, w.labels); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
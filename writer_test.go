@@ -0,0 +1,67 @@
+package zaploki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestWriter(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer c.Stop()
+
+	w := c.Writer()
+	fmt.Fprint(w, `{"level":"warn","message":"from json"}`+"\n"+"plain ")
+	fmt.Fprint(w, "text\n")
+	assert.NoError(t, c.Flush(context.Background()))
+
+	req := <-received
+	assert.Len(t, req.Streams, 1, "Expected one stream")
+	values := req.Streams[0].Values
+	assert.Len(t, values, 2, "Expected one value per line")
+	assert.Equal(t, `{"level":"warn","message":"from json"}`, values[0][1])
+	assert.Equal(t, "plain text", values[1][1])
+	assert.NotEqual(t, "0", values[1][0], "Expected lines without a timestamp to use the current time")
+}
+
+func TestStdLogger(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	c := NewClient(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+	})
+	defer c.Stop()
+
+	c.StdLogger(zapcore.ErrorLevel, map[string]string{"source": "http"}).Printf("bad request from %s", "client")
+	assert.NoError(t, c.Flush(context.Background()))
+
+	req := <-received
+	assert.Equal(t, map[string]string{"app": "test", "source": "http"}, req.Streams[0].Stream)
+
+	var entry logEntry
+	assert.NoError(t, json.Unmarshal([]byte(req.Streams[0].Values[0][1]), &entry))
+	assert.Equal(t, "error", entry.Level)
+	assert.Equal(t, "bad request from client", entry.Message)
+}
@@ -5,12 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func testServer(t *testing.T, test func(t *testing.T, req lokiPushRequest)) *httptest.Server {
@@ -19,19 +21,22 @@ func testServer(t *testing.T, test func(t *testing.T, req lokiPushRequest)) *htt
 		assert.Equal(t, "application/json", r.Header.Get("Content-Type"), "Expected Content-Type application/json")
 		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"), "Expected Content-Encoding gzip")
 
-		var req lokiPushRequest
-		gz, err := gzip.NewReader(r.Body)
-		assert.NoError(t, err, "Failed to create gzip reader")
-
-		defer gz.Close()
-		assert.NoError(t, json.NewDecoder(gz).Decode(&req), "Failed to decode json from gzip")
-
-		test(t, req)
+		test(t, decodePushRequest(t, r))
 
 		w.WriteHeader(http.StatusNoContent)
 	}))
 }
 
+func decodePushRequest(t *testing.T, r *http.Request) lokiPushRequest {
+	var req lokiPushRequest
+	gz, err := gzip.NewReader(r.Body)
+	assert.NoError(t, err, "Failed to create gzip reader")
+
+	defer gz.Close()
+	assert.NoError(t, json.NewDecoder(gz).Decode(&req), "Failed to decode json from gzip")
+	return req
+}
+
 func TestNew(t *testing.T) {
 	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
 		assert.Len(t, req.Streams, 1, "Expected one stream")
@@ -56,3 +61,219 @@ func TestNew(t *testing.T) {
 	logger.Info("test message", zap.String("key", "value"))
 	defer logger.Sync()
 }
+
+func TestWithCreateLoggerReusesSinkKey(t *testing.T) {
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {})
+	defer mockServer.Close()
+
+	for i := 0; i < 2; i++ {
+		v := New(context.Background(), Config{
+			Url:          mockServer.URL,
+			SinkKey:      "loki-reuse",
+			BatchMaxSize: 100,
+			BatchMaxWait: 10 * time.Second,
+		})
+		logger, err := v.WithCreateLogger(zap.NewProductionConfig())
+		assert.NoError(t, err, "Expected sink key to be rebound")
+		logger.Info("test message")
+		v.Stop()
+	}
+}
+
+func TestMultipleInstances(t *testing.T) {
+	received := make(chan map[string]string, 2)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		for _, s := range req.Streams {
+			received <- s.Stream
+		}
+	})
+	defer mockServer.Close()
+
+	for _, app := range []string{"first", "second"} {
+		v := New(context.Background(), Config{
+			Url:          mockServer.URL,
+			BatchMaxSize: 100,
+			BatchMaxWait: 10 * time.Second,
+			Labels:       map[string]string{"app": app},
+		})
+		logger, err := v.WithCreateLogger(zap.NewProductionConfig())
+		assert.NoError(t, err, "Expected independent sinks per instance")
+		logger.Info("test message")
+		v.Stop()
+		assert.Equal(t, map[string]string{"app": app}, <-received, "Expected labels of the instance")
+	}
+}
+
+func TestWriteSyncer(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	v := New(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 1,
+		BatchMaxWait: 10 * time.Second,
+		Labels:       map[string]string{"app": "test"},
+	})
+	defer v.Stop()
+
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), v.WriteSyncer(), zapcore.InfoLevel)
+	zap.New(core).Info("test message")
+
+	req := <-received
+	assert.Len(t, req.Streams, 1, "Expected one stream")
+	assert.Contains(t, req.Streams[0].Values[0][1], "test message")
+}
+
+func TestZapOption(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	v := New(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 1,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer v.Stop()
+
+	existing := zapcore.NewCore(zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.AddSync(io.Discard), zapcore.InfoLevel)
+	logger := zap.New(existing).WithOptions(v.ZapOption())
+	logger.Debug("skipped")
+	logger.Info("test message")
+
+	req := <-received
+	assert.Contains(t, req.Streams[0].Values[0][1], "test message")
+}
+
+func TestWithCreateLoggerTee(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	v := New(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 1,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer v.Stop()
+
+	cfg := zap.NewDevelopmentConfig()
+	cfg.OutputPaths = []string{"stderr"}
+	logger, err := v.WithCreateLoggerTee(cfg, zapcore.WarnLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("skipped")
+	logger.Warn("test message")
+
+	req := <-received
+	assert.Len(t, req.Streams[0].Values, 1, "Expected one value")
+	assert.Contains(t, req.Streams[0].Values[0][1], "test message")
+}
+
+func TestPushEntry(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	v := New(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 1,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer v.Stop()
+
+	err := v.PushEntry(context.Background(), "info", "user deleted", map[string]any{"audit": true, "user": "bob"})
+	assert.NoError(t, err)
+
+	req := <-received
+	var line map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(req.Streams[0].Values[0][1]), &line))
+	assert.Equal(t, "user deleted", line["msg"])
+	assert.Equal(t, true, line["audit"])
+	assert.Equal(t, "bob", line["user"])
+}
+
+func TestFlush(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	v := New(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer v.Stop()
+
+	logger, err := v.WithCreateLogger(zap.NewProductionConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("test message")
+	assert.NoError(t, v.Flush(context.Background()))
+
+	select {
+	case req := <-received:
+		assert.Contains(t, req.Streams[0].Values[0][1], "test message")
+	default:
+		t.Fatal("Expected Flush to send the pending lines")
+	}
+}
+
+func TestSyncSendsQueuedEntries(t *testing.T) {
+	received := make(chan lokiPushRequest, 1)
+	mockServer := testServer(t, func(t *testing.T, req lokiPushRequest) {
+		received <- req
+	})
+	defer mockServer.Close()
+
+	v := New(context.Background(), Config{
+		Url:          mockServer.URL,
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	defer v.Stop()
+
+	cfg := zap.NewProductionConfig()
+	cfg.OutputPaths = nil
+	logger, err := v.WithCreateLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		logger.Info("test message")
+	}
+	assert.NoError(t, logger.Sync())
+
+	select {
+	case req := <-received:
+		assert.Len(t, req.Streams[0].Values, 10, "Expected every line to be sent")
+	default:
+		t.Fatal("Expected Sync to send the pending lines")
+	}
+}
+
+func TestWriteAfterStop(t *testing.T) {
+	v := New(context.Background(), Config{
+		Url:          "http://localhost",
+		BatchMaxSize: 100,
+		BatchMaxWait: 10 * time.Second,
+	})
+	v.Stop()
+
+	assert.ErrorIs(t, v.Hook(zapcore.Entry{Message: "late"}), ErrStopped)
+	_, err := v.WriteSyncer().Write([]byte(`{"level":"info","msg":"late"}`))
+	assert.ErrorIs(t, err, ErrStopped)
+}